@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/backend"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+	"github.com/LoboGuardian/pulsego/internal/output"
+)
+
+// dashboard holds the page served at /, which polls GET /last, and the
+// one served with -watch, which polls GET /stats and GET /timeline.
+//
+//go:embed web/index.html web/watch.html
+var dashboard embed.FS
+
+// testRequest is the optional JSON body of POST /test.
+type testRequest struct {
+	URL         string `json:"url"`
+	Connections int    `json:"connections"`
+}
+
+// apiServer runs tests on demand. Only one test runs at a time: later
+// requests wait for the slot so overlapping tests never share the link.
+type apiServer struct {
+	backend   backend.Backend
+	scale     metrics.GradeScale
+	fields    []string
+	bounds    []time.Duration
+	portSpecs []metrics.PortSpec
+
+	slot chan struct{}
+
+	mu   sync.Mutex
+	last []byte
+
+	// lastGrade is the grade of the result in last, for GET /ready.
+	lastGrade string
+
+	// warming is set while the startup test of -warm-serve pending runs.
+	warming bool
+}
+
+func runAPI(addr string, b backend.Backend, scale metrics.GradeScale, fields []string, bounds []time.Duration, portSpecs []metrics.PortSpec) {
+	s := &apiServer{
+		backend:   b,
+		scale:     scale,
+		fields:    fields,
+		bounds:    bounds,
+		portSpecs: portSpecs,
+		slot:      make(chan struct{}, 1),
+	}
+	if *readyGrade != "" && scale.Rank(*readyGrade) < 0 {
+		fmt.Printf("Error: -ready-grade %q is not a grade of the scale (%s)\n", *readyGrade, strings.Join(scale.Grades(), ", "))
+		os.Exit(1)
+	}
+
+	// The startup test takes the slot like any other, so a POST /test that
+	// arrives while it runs waits for it.
+	switch *warmServe {
+	case "sync":
+		s.warm()
+	case "pending":
+		s.warming = true
+		s.slot <- struct{}{}
+		go func() {
+			defer func() { <-s.slot }()
+			s.runWarm()
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/test", s.handleTest)
+	mux.HandleFunc("/last", s.handleLast)
+	mux.HandleFunc("/ready", s.handleReady)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/", handleDashboard)
+
+	fmt.Printf("PulseGo API listening on %s (dashboard at /, POST /test, GET /last, GET /ready)\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func (s *apiServer) handleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := testParams{URL: *url, Backend: s.backend.Name(), Downloads: *downloads}
+	var req testRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.URL != "" {
+		u, err := neturl.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, fmt.Sprintf("invalid url %q", req.URL), http.StatusBadRequest)
+			return
+		}
+		p.URL = req.URL
+		p.Backend = "custom"
+	}
+	if req.Connections < 0 || req.Connections > 64 {
+		http.Error(w, "connections must be between 1 and 64", http.StatusBadRequest)
+		return
+	}
+	if req.Connections > 0 {
+		p.Downloads = req.Connections
+	}
+
+	select {
+	case s.slot <- struct{}{}:
+		defer func() { <-s.slot }()
+	case <-r.Context().Done():
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), *timeout*3)
+	defer cancel()
+
+	status, data := s.run(ctx, p)
+	writeJSON(w, status, data)
+}
+
+// run measures p and returns the HTTP status and JSON body to answer with.
+// A successful result also becomes the one GET /last returns. The caller
+// holds the slot.
+func (s *apiServer) run(ctx context.Context, p testParams) (int, []byte) {
+	fmt.Printf("%s test: %s (%d connections)\n", time.Now().Format("15:04:05"), p.URL, p.Downloads)
+	rep, err := measure(ctx, p, s.bounds, s.portSpecs)
+	if err != nil {
+		d := metrics.Diagnose(ctx, p.URL, 10*time.Second)
+		return http.StatusBadGateway, []byte(output.FormatFailure(err, d, "json", tags))
+	}
+	rep.Scale, rep.Precision, rep.Fields, rep.Tags = s.scale, *precision, s.fields, tags
+	grade(rep)
+
+	data := []byte(output.FormatJSON(rep) + "\n")
+	s.mu.Lock()
+	s.last = data
+	s.lastGrade = rep.Health.Grade
+	s.mu.Unlock()
+	return http.StatusOK, data
+}
+
+// warm runs the startup test of -warm-serve sync before the server starts
+// listening, so the first GET /last already has a result.
+func (s *apiServer) warm() {
+	s.slot <- struct{}{}
+	defer func() { <-s.slot }()
+	s.runWarm()
+}
+
+func (s *apiServer) runWarm() {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout*3)
+	defer cancel()
+
+	p := testParams{URL: *url, Backend: s.backend.Name(), Downloads: *downloads}
+	if status, _ := s.run(ctx, p); status != http.StatusOK {
+		fmt.Println("Warning: startup test failed; GET /last stays empty until a test succeeds")
+	}
+	s.mu.Lock()
+	s.warming = false
+	s.mu.Unlock()
+}
+
+func (s *apiServer) handleLast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	data, warming := s.last, s.warming
+	s.mu.Unlock()
+
+	if data == nil && warming {
+		w.Header().Set("Retry-After", strconv.Itoa(int((*timeout * 3).Seconds())))
+		writeJSON(w, http.StatusServiceUnavailable, []byte(`{"status": "pending"}`+"\n"))
+		return
+	}
+	if data == nil {
+		http.Error(w, "no test has run yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, data)
+}
+
+// handleReady answers 200 when the grade of the last result is at or above
+// min-grade, or -ready-grade, and 503 otherwise, with a one-line body, for
+// orchestrators that gate traffic on network health. Unlike /healthz it
+// says nothing about the process itself.
+func (s *apiServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	grades := s.scale.Grades()
+	minRank := (len(grades)+1)/2 - 1
+	if q := r.URL.Query().Get("min-grade"); q != "" {
+		minRank = s.scale.Rank(q)
+		if minRank < 0 {
+			http.Error(w, fmt.Sprintf("unknown grade %q (want one of %s)", q, strings.Join(grades, ", ")), http.StatusBadRequest)
+			return
+		}
+	} else if *readyGrade != "" {
+		minRank = s.scale.Rank(*readyGrade)
+	}
+	want := grades[minRank]
+
+	s.mu.Lock()
+	last := s.lastGrade
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch rank := s.scale.Rank(last); {
+	case last == "":
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ready: no test has run yet")
+	case rank < 0 || rank > minRank:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: grade %s is below %s\n", last, want)
+	default:
+		fmt.Fprintf(w, "ready: grade %s (minimum %s)\n", last, want)
+	}
+}
+
+// handleHealthz reports that the server process is up, whatever the state
+// of the network; see handleReady for that.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	http.ServeFileFS(w, r, dashboard, "web/index.html")
+}
+
+func writeJSON(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
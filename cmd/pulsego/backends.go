@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/backend"
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+type backendResult struct {
+	Backend   string  `json:"backend"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Mbps      float64 `json:"download_mbps,omitempty"`
+	Bytes     int64   `json:"bytes,omitempty"`
+	Error     string  `json:"error,omitempty"`
+
+	// Outlier is set when the backend is much slower or further away than
+	// the best of the others.
+	Outlier bool `json:"outlier,omitempty"`
+
+	latency time.Duration
+}
+
+// parseBackendList resolves -compare-backends, where "all" stands for every
+// registered backend.
+func parseBackendList(spec string) ([]backend.Backend, error) {
+	names := strings.Split(spec, ",")
+	if strings.TrimSpace(spec) == "all" {
+		names = backend.Names()
+	}
+	var list []backend.Backend
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		b, err := backend.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	if len(list) < 2 {
+		return nil, fmt.Errorf("-compare-backends needs at least two backends, e.g. %s", strings.Join(backend.Names(), ","))
+	}
+	return list, nil
+}
+
+// runCompareBackends runs the latency and download test against each
+// backend in turn, never in parallel so they do not compete for the link,
+// and flags the ones that fall far behind the best. A link that is fast to
+// one server and slow to another is limited by the route between them,
+// such as an ISP's peering, rather than by the line itself.
+func runCompareBackends(spec string) {
+	list, err := parseBackendList(spec)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var results []*backendResult
+	for _, b := range list {
+		res := &backendResult{Backend: b.Name()}
+		results = append(results, res)
+		if progress() {
+			fmt.Printf("Testing %s (%d connections)...\n", b.Name(), *downloads)
+		}
+
+		// Each backend gets the full time budget of a normal run.
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout*3)
+		u := b.DownloadURL(testBytes)
+		res.latency, err = warmLatency(ctx, u)
+		if err != nil {
+			res.Error = describeError(err)
+			cancel()
+			continue
+		}
+		res.LatencyMs = float64(res.latency) / float64(time.Millisecond)
+
+		result, err := engine.Run(ctx, engine.Config{
+			URL:              u,
+			Downloads:        *downloads,
+			Timeout:          *timeout,
+			AllowCompression: *compress,
+		})
+		cancel()
+		if err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		res.Mbps = result.DownloadSpeed
+		res.Bytes = result.BytesReceived
+	}
+
+	notes := backendOutliers(results)
+
+	if *format == "json" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"backends": results,
+			"notes":    notes,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("\n%-12s %12s %16s\n", "Backend", "Latency", "Download")
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Printf("%-12s %s\n", res.Backend, res.Error)
+			continue
+		}
+		mark := ""
+		if res.Outlier {
+			mark = " *"
+		}
+		fmt.Printf("%-12s %12s %11.2f Mbps%s\n", res.Backend, metrics.FormatDuration(res.latency), res.Mbps, mark)
+	}
+	if len(notes) > 0 {
+		fmt.Println()
+		for _, n := range notes {
+			fmt.Printf("* %s\n", n)
+		}
+		fmt.Println("A link that is fast to one server and slow to another is limited by the route to that server, such as your ISP's peering with it, not by the line itself.")
+	}
+}
+
+// backendOutliers marks and describes each backend whose throughput is
+// under half of the fastest one's, or whose latency is at least 50% and
+// 20ms worse than the lowest, using the same thresholds as -dual.
+func backendOutliers(results []*backendResult) []string {
+	var best *backendResult
+	var nearest time.Duration
+	for _, res := range results {
+		if res.Error != "" {
+			continue
+		}
+		if best == nil || res.Mbps > best.Mbps {
+			best = res
+		}
+		if nearest == 0 || res.latency < nearest {
+			nearest = res.latency
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	var notes []string
+	for _, res := range results {
+		if res.Error != "" {
+			continue
+		}
+		if best.Mbps > 0 && res.Mbps < best.Mbps/2 {
+			res.Outlier = true
+			notes = append(notes, fmt.Sprintf("%s downloads %.1fx slower than %s", res.Backend, best.Mbps/max(res.Mbps, 0.01), best.Backend))
+		}
+		if res.latency > nearest*3/2 && res.latency-nearest > 20*time.Millisecond {
+			res.Outlier = true
+			notes = append(notes, fmt.Sprintf("%s latency is %.1fx the lowest", res.Backend, float64(res.latency)/float64(nearest)))
+		}
+	}
+	return notes
+}
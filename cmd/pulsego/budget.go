@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// probeReserve is set aside from a -data-budget for the latency, jitter and
+// one-way delay probes, which close their responses after the headers.
+const probeReserve = 1 << 20
+
+// minBudgetDownload is the smallest download share that still gives a
+// meaningful throughput figure; fast links finish less in a blink.
+const minBudgetDownload = 5 << 20
+
+// budgetPlan is how a -data-budget is split across phases. A zero share
+// means no cap.
+type budgetPlan struct {
+	total       int64
+	download    int64
+	bufferbloat int64
+}
+
+// parseBytes accepts a plain byte count or a number with a KB, MB or GB
+// suffix (powers of 1024), e.g. 50MB or 1.5GB.
+func parseBytes(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(t, u.suffix) {
+			t, mult = strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), u.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid size %q: use a byte count or a value such as 50MB", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// budget is the plan for -data-budget; its total is 0 without one.
+var budget budgetPlan
+
+// planBudget reserves probeReserve for the probes (at most half of a tiny
+// budget) and gives a fifth of the rest to the bufferbloat load, when those
+// phases run; the download gets the remainder.
+func planBudget(total int64) budgetPlan {
+	plan := budgetPlan{total: total}
+	rest := max(total-probeReserve, total/2)
+	switch {
+	case selected["download"] && selected["bufferbloat"]:
+		plan.bufferbloat = rest / 5
+		plan.download = rest - plan.bufferbloat
+	case selected["download"]:
+		plan.download = rest
+	case selected["bufferbloat"]:
+		plan.bufferbloat = rest
+	}
+	return plan
+}
+
+// warning explains why the plan is unlikely to give a useful result, or
+// returns "".
+func (p budgetPlan) warning() string {
+	if selected["download"] && p.download < minBudgetDownload {
+		return fmt.Sprintf("a %s data budget leaves %s for the download, too little for a meaningful throughput measurement",
+			formatSize(p.total), formatSize(p.download))
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+	"github.com/LoboGuardian/pulsego/internal/output"
+)
+
+// bundleFile is one artifact in a -bundle zip, listed in its manifest.
+type bundleFile struct {
+	Name        string `json:"name"`
+	Bytes       int    `json:"bytes"`
+	Description string `json:"description"`
+	data        []byte
+}
+
+type bundleManifest struct {
+	Tool    string       `json:"tool"`
+	Version string       `json:"version"`
+	Created time.Time    `json:"created"`
+	Status  string       `json:"status"`
+	Files   []bundleFile `json:"files"`
+}
+
+type bundleEnv struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	OS        string            `json:"os"`
+	Arch      string            `json:"arch"`
+	CPUs      int               `json:"cpus"`
+	UserAgent string            `json:"user_agent"`
+	Args      []string          `json:"args"`
+	Flags     map[string]string `json:"flags"`
+}
+
+// bundlePings is the -ping count of a -bundle run that did not give one.
+const bundlePings = 10
+
+// bundleDiagnostics turns on the route diagnostics a -bundle run adds to
+// every measurement phase: a ping, unless -ping already set a count, and
+// a traceroute.
+func bundleDiagnostics() {
+	if *bundle == "" {
+		return
+	}
+	if *pingCount <= 0 {
+		*pingCount = bundlePings
+	}
+	*traceRoute = true
+}
+
+// writeBundle collects the artifacts of a run into the -bundle zip: the
+// full JSON and text results, the raw jitter samples, a connection trace,
+// the traceroute and the environment, plus a manifest. r is nil when the
+// run failed, in which case runErr and its diagnostics d are recorded
+// instead and the route is traced here. d is nil for a successful run and
+// is traced here.
+func writeBundle(path string, r *output.Report, runErr error, d *metrics.Diagnostics) error {
+	var files []bundleFile
+	add := func(name, desc string, data []byte) {
+		files = append(files, bundleFile{Name: name, Bytes: len(data), Description: desc, data: data})
+	}
+
+	status := "ok"
+	var route *metrics.TracerouteResult
+	if r != nil {
+		route = r.Traceroute
+		full := *r
+		full.Fields = nil
+		grade(&full)
+		add("result.json", "Full result in JSON", []byte(render(&full, "json")))
+		add("result.txt", "Result as printed by the text format", []byte(render(&full, "text")))
+		if r.Failure != "" {
+			status = "failed"
+		}
+
+		if r.Jitter != nil {
+			var buf bytes.Buffer
+			if err := output.WriteSamplesCSV(&buf, r.Jitter.Raw, true); err != nil {
+				return err
+			}
+			add("samples.csv", "Every jitter latency sample", buf.Bytes())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		d = metrics.Diagnose(ctx, *url, 10*time.Second)
+		cancel()
+	} else {
+		status = "failed"
+		add("result.json", "Failure and connection diagnostics in JSON", []byte(output.FormatFailure(runErr, d, "json", tags)))
+		add("result.txt", "Failure as printed by the text format", []byte(output.FormatFailure(runErr, d, "text", tags)))
+	}
+	add("connection.json", "DNS, TCP, TLS and HTTP trace to the test server", []byte(output.FormatDiagnosticsJSON(d)+"\n"))
+
+	// A failed run may have stopped before its traceroute, and a failure is
+	// when the route matters most.
+	if route == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		route, _ = metrics.Traceroute(ctx, *url, 30, 2*time.Second)
+		cancel()
+	}
+	if route != nil {
+		add("traceroute.json", "Route to the test server, one entry per hop", []byte(output.FormatTracerouteJSON(route)+"\n"))
+	}
+
+	env, err := json.MarshalIndent(environment(), "", "  ")
+	if err != nil {
+		return err
+	}
+	add("environment.json", "PulseGo version, platform and command line", append(env, '\n'))
+
+	manifest, err := json.MarshalIndent(bundleManifest{
+		Tool:    "pulsego",
+		Version: httpclient.Version,
+		Created: time.Now(),
+		Status:  status,
+		Files:   files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	now := time.Now()
+	for _, bf := range append([]bundleFile{{Name: "manifest.json", data: append(manifest, '\n')}}, files...) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: bf.Name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			_, err = w.Write(bf.data)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func environment() bundleEnv {
+	env := bundleEnv{
+		Version:   httpclient.Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		UserAgent: requestUserAgent(),
+		Args:      os.Args[1:],
+		Flags:     map[string]string{},
+	}
+	if env.UserAgent == "" {
+		env.UserAgent = httpclient.DefaultUserAgent()
+	}
+	flag.Visit(func(f *flag.Flag) {
+		env.Flags[f.Name] = f.Value.String()
+	})
+	return env
+}
+
+// saveBundle writes the -bundle zip, if requested, and reports where it
+// went.
+func saveBundle(r *output.Report, runErr error, d *metrics.Diagnostics) {
+	if *bundle == "" {
+		return
+	}
+	if err := writeBundle(*bundle, r, runErr, d); err != nil {
+		fmt.Printf("Warning: could not write bundle: %v\n", err)
+		return
+	}
+	if progress() {
+		fmt.Printf("Diagnostic bundle written to %s\n", *bundle)
+	}
+}
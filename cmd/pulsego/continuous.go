@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/backend"
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// continuousBytes is the file each -continuous run downloads from a
+// built-in backend: enough to reach speed on most links while keeping a
+// run every few seconds affordable.
+const continuousBytes = 5 << 20
+
+type continuousSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Mbps      float64   `json:"download_mbps,omitempty"`
+	DeltaMbps float64   `json:"delta_mbps,omitempty"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// continuousSummary aggregates the successful runs. The coefficients of
+// variation and the repeatability label need at least two of them.
+type continuousSummary struct {
+	Runs          int     `json:"runs"`
+	MinMbps       float64 `json:"min_mbps"`
+	AvgMbps       float64 `json:"avg_mbps"`
+	MaxMbps       float64 `json:"max_mbps"`
+	DownloadCV    float64 `json:"download_cv,omitempty"`
+	LatencyCV     float64 `json:"latency_cv,omitempty"`
+	Repeatability string  `json:"repeatability,omitempty"`
+}
+
+// runContinuous repeats the download test every -interval and prints each
+// speed with its change from the previous run, until interrupted or after
+// -count runs. Each run also takes one latency probe, so the summary can
+// say how repeatable both figures were.
+func runContinuous(b backend.Backend) {
+	target := *url
+	if b.Name() != "custom" {
+		target = b.DownloadURL(continuousBytes)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if progress() {
+		fmt.Printf("Continuous download test every %v (Ctrl+C to stop)\n", *interval)
+	}
+
+	var speeds, latencies []float64
+	var prev float64
+	for runs := 1; ; runs++ {
+		s := continuousSample{Timestamp: time.Now()}
+		if l, err := metrics.MeasureLatency(ctx, target); err == nil {
+			s.LatencyMs = float64(l.Latency) / float64(time.Millisecond)
+		}
+		result, err := engine.Run(ctx, engine.Config{
+			URL:              target,
+			Downloads:        *downloads,
+			Timeout:          *timeout,
+			AllowCompression: *compress,
+		})
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err != nil {
+			s.Error = err.Error()
+		} else {
+			s.Mbps = result.DownloadSpeed
+			if prev > 0 {
+				s.DeltaMbps = s.Mbps - prev
+			}
+			prev = s.Mbps
+			speeds = append(speeds, s.Mbps)
+			if s.LatencyMs > 0 {
+				latencies = append(latencies, s.LatencyMs)
+			}
+		}
+		printContinuous(s)
+
+		if *count > 0 && runs >= *count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(speeds) > 0 {
+		printContinuousSummary(summarizeContinuous(speeds, latencies))
+	}
+}
+
+func summarizeContinuous(speeds, latencies []float64) continuousSummary {
+	sum := continuousSummary{Runs: len(speeds), MinMbps: speeds[0], MaxMbps: speeds[0]}
+	var total float64
+	for _, v := range speeds {
+		sum.MinMbps, sum.MaxMbps, total = min(sum.MinMbps, v), max(sum.MaxMbps, v), total+v
+	}
+	sum.AvgMbps = total / float64(len(speeds))
+	if len(speeds) < 2 {
+		return sum
+	}
+	// A figure is only as trustworthy as the less repeatable of the two.
+	sum.DownloadCV = metrics.CoefficientOfVariation(speeds)
+	sum.LatencyCV = metrics.CoefficientOfVariation(latencies)
+	sum.Repeatability = metrics.Repeatability(max(sum.DownloadCV, sum.LatencyCV))
+	return sum
+}
+
+func printContinuousSummary(sum continuousSummary) {
+	if *format == "json" {
+		data, _ := json.Marshal(map[string]continuousSummary{"summary": sum})
+		fmt.Println(string(data))
+		return
+	}
+	if !progress() {
+		return
+	}
+	fmt.Printf("\n%d runs | Min: %.2f Mbps | Avg: %.2f Mbps | Max: %.2f Mbps\n",
+		sum.Runs, sum.MinMbps, sum.AvgMbps, sum.MaxMbps)
+	if sum.Repeatability == "" {
+		return
+	}
+	fmt.Printf("Repeatability: %s | Download CV: %.1f%% | Latency CV: %.1f%%\n",
+		sum.Repeatability, sum.DownloadCV*100, sum.LatencyCV*100)
+	if sum.Repeatability == "low" {
+		fmt.Println("Note: results vary widely from run to run, so no single figure is reliable; an unstable link or a busy test server is likely")
+	}
+}
+
+func printContinuous(s continuousSample) {
+	if *format == "json" {
+		data, _ := json.Marshal(s)
+		fmt.Println(string(data))
+		return
+	}
+
+	ts := s.Timestamp.Format("15:04:05")
+	if s.Error != "" {
+		fmt.Printf("[%s] Error: %s\n", ts, s.Error)
+		return
+	}
+	line := fmt.Sprintf("[%s] %10.2f Mbps", ts, s.Mbps)
+	switch prev := s.Mbps - s.DeltaMbps; {
+	case s.DeltaMbps > 0:
+		line += fmt.Sprintf("  ↑ +%.2f (%+.1f%%)", s.DeltaMbps, s.DeltaMbps/prev*100)
+	case s.DeltaMbps < 0:
+		line += fmt.Sprintf("  ↓ %.2f (%+.1f%%)", s.DeltaMbps, s.DeltaMbps/prev*100)
+	}
+	if s.LatencyMs > 0 {
+		line += fmt.Sprintf("  latency %s", metrics.FormatDuration(time.Duration(s.LatencyMs*float64(time.Millisecond))))
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+type familyResult struct {
+	Family    string  `json:"family"`
+	Address   string  `json:"address,omitempty"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Mbps      float64 `json:"download_mbps,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Skipped   bool    `json:"skipped,omitempty"`
+
+	latency time.Duration
+}
+
+// runDual measures the same host over IPv4 and then IPv6 by pinning the
+// shared transport to one family at a time, and flags a family that is
+// much worse than the other.
+func runDual(ctx context.Context) {
+	host := hostOf(*url)
+	if host == "" {
+		fmt.Printf("Error: cannot determine host of %q\n", *url)
+		os.Exit(1)
+	}
+
+	base := httpclient.Current()
+	defer httpclient.Configure(base)
+
+	families := []struct{ name, network, lookup string }{
+		{"IPv4", "tcp4", "ip4"},
+		{"IPv6", "tcp6", "ip6"},
+	}
+
+	var results []*familyResult
+	for _, f := range families {
+		res := &familyResult{Family: f.name}
+		results = append(results, res)
+
+		ips, err := net.DefaultResolver.LookupIP(ctx, f.lookup, host)
+		if err != nil || len(ips) == 0 {
+			res.Error = fmt.Sprintf("no %s address for %s", f.name, host)
+			res.Skipped = true
+			continue
+		}
+		res.Address = ips[0].String()
+
+		opts := base
+		opts.Family = f.network
+		if err := httpclient.Configure(opts); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+
+		if progress() {
+			fmt.Printf("Measuring %s (%s)...\n", f.name, res.Address)
+		}
+		res.latency, err = warmLatency(ctx, *url)
+		if err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		res.LatencyMs = float64(res.latency) / float64(time.Millisecond)
+
+		if *dualDL {
+			result, err := engine.Run(ctx, engine.Config{
+				URL:              *url,
+				Downloads:        *downloads,
+				Timeout:          *timeout,
+				AllowCompression: *compress,
+			})
+			if err != nil {
+				res.Error = err.Error()
+				continue
+			}
+			res.Mbps = result.DownloadSpeed
+		}
+	}
+
+	verdict := dualVerdict(results[0], results[1])
+
+	if *format == "json" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"host":     host,
+			"families": results,
+			"verdict":  verdict,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("\n%-6s %-40s %12s %12s\n", "Family", "Address", "Latency", "Download")
+	for _, res := range results {
+		if res.Error != "" {
+			fmt.Printf("%-6s %s\n", res.Family, res.Error)
+			continue
+		}
+		download := "-"
+		if *dualDL {
+			download = fmt.Sprintf("%.2f Mbps", res.Mbps)
+		}
+		fmt.Printf("%-6s %-40s %12v %12s\n", res.Family, res.Address, metrics.FormatDuration(res.latency), download)
+	}
+	if verdict != "" {
+		fmt.Printf("\n%s\n", verdict)
+	}
+}
+
+// warmLatency returns the median of five requests to u after a first one
+// that sets up the connection.
+func warmLatency(ctx context.Context, u string) (time.Duration, error) {
+	if _, err := metrics.MeasureLatency(ctx, u); err != nil {
+		return 0, err
+	}
+
+	var samples []time.Duration
+	for i := 0; i < 5; i++ {
+		l, err := metrics.MeasureLatency(ctx, u)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, l.Latency)
+	}
+	if len(samples) == 0 {
+		return 0, fmt.Errorf("no latency samples succeeded")
+	}
+	return metrics.Median(samples), nil
+}
+
+// dualVerdict flags a family whose latency is at least 50% and 20ms worse,
+// or whose throughput is under half of the other's.
+func dualVerdict(v4, v6 *familyResult) string {
+	if v4.Error != "" || v6.Error != "" {
+		switch {
+		case v4.Error != "" && v6.Error != "":
+			return ""
+		case v4.Skipped || v6.Skipped:
+			return ""
+		case v6.Error != "":
+			return "Warning: IPv6 failed while IPv4 works; IPv6 connectivity looks broken."
+		default:
+			return "Warning: IPv4 failed while IPv6 works."
+		}
+	}
+
+	worse := func(a, b *familyResult) string {
+		if a.latency > b.latency*3/2 && a.latency-b.latency > 20*time.Millisecond {
+			return fmt.Sprintf("Warning: %s latency is %.1fx %s", a.Family, float64(a.latency)/float64(b.latency), b.Family)
+		}
+		if b.Mbps > 0 && a.Mbps < b.Mbps/2 {
+			return fmt.Sprintf("Warning: %s throughput is %.0f%% of %s", a.Family, a.Mbps/b.Mbps*100, b.Family)
+		}
+		return ""
+	}
+	if w := worse(v6, v4); w != "" {
+		return w
+	}
+	if w := worse(v4, v6); w != "" {
+		return w
+	}
+	return "IPv4 and IPv6 perform comparably."
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/history"
+	"github.com/LoboGuardian/pulsego/internal/output"
+)
+
+// recordHistory compares a fresh result with the earlier runs to the same
+// target in the -history file, then appends it. A failed run is neither
+// compared nor recorded, so it cannot drag the averages down.
+func recordHistory(r *output.Report) {
+	if *histFile == "" || r.Failure != "" {
+		return
+	}
+
+	cur := history.Entry{Time: time.Now(), Target: *url}
+	if r.Download != nil {
+		cur.DownloadMbps = r.Download.DownloadSpeed
+	}
+	latency := r.MedianLatency
+	if latency == 0 && r.Latency != nil {
+		latency = r.Latency.Latency
+	}
+	cur.LatencyMs = float64(latency) / float64(time.Millisecond)
+	if r.Jitter != nil && !r.Jitter.Insufficient {
+		cur.JitterMs = float64(r.Jitter.Jitter) / float64(time.Millisecond)
+	}
+
+	past, err := history.Load(*histFile, cur.Target)
+	if err != nil {
+		fmt.Printf("Warning: could not read history: %v\n", err)
+		return
+	}
+	r.History = history.Compute(past, cur, *histWindow)
+	if err := history.Append(*histFile, cur); err != nil {
+		fmt.Printf("Warning: could not write history: %v\n", err)
+	}
+}
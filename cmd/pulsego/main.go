@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	neturl "net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/LoboGuardian/pulsego/internal/backend"
+	"github.com/LoboGuardian/pulsego/internal/cache"
 	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
 	"github.com/LoboGuardian/pulsego/internal/metrics"
 	"github.com/LoboGuardian/pulsego/internal/output"
 	"github.com/LoboGuardian/pulsego/internal/watchdog"
@@ -16,34 +26,367 @@ import (
 
 var (
 	simple     = flag.Bool("simple", false, "Simple output for humans")
-	format     = flag.String("format", "text", "Output format: text, json, prometheus")
-	url        = flag.String("url", "http://speedtest.tele2.net/10MB.zip", "URL for speed test")
+	expectSHA  = flag.String("expect-sha256", "", "Hash the downloaded content and fail the run unless every complete download has this SHA-256")
+	dataBudget = flag.String("data-budget", "", "Use at most this much data for the whole run, e.g. 50MB; most of it goes to the download")
+	pprofAddr  = flag.String("pprof", "", "Serve net/http/pprof profiles of PulseGo itself on this address, e.g. localhost:6060")
+	timing     = flag.Bool("timing", false, "Print how long each phase of the run took")
+	bundle     = flag.String("bundle", "", "Run every measurement phase, a ping and a traceroute, and write all results, raw samples, a connection trace, the route and environment info to this zip file")
+	metricList = flag.String("metrics", "", "Comma-separated phases to run: latency, download, jitter, bufferbloat (overrides -jitter and -bufferbloat)")
+	quiet      = flag.Bool("quiet", false, "Suppress banners and progress lines; print only the final result")
+	noBanner   = flag.Bool("no-banner", false, "Leave the banner and decorative lines out of text output, keeping progress and metric lines, for scripts (implied by -quiet)")
+	format     = flag.String("format", "text", "Output format: text, json, prometheus, csv")
+	precision  = flag.Int("precision", -1, "Decimal places for Mbps values (-1 keeps the format's default)")
+	fieldList  = flag.String("fields", "", "Comma-separated fields to include in json and csv output")
+	alsoFormat = flag.String("also-format", "", "Additional outputs written to files, e.g. json=run.json,prometheus=run.prom")
+	url        = flag.String("url", "", "URL for speed test (overrides -backend)")
+	backendArg = flag.String("backend", backend.Default, "Test service to download from; see -list-backends")
+	listBack   = flag.Bool("list-backends", false, "List the available test backends and exit")
 	downloads  = flag.Int("downloads", 4, "Number of simultaneous connections")
 	timeout    = flag.Duration("timeout", 120*time.Second, "Timeout per download")
 	jitter     = flag.Bool("jitter", true, "Measure jitter")
 	bbloat     = flag.Bool("bufferbloat", true, "Measure bufferbloat")
+	bloatDir   = flag.String("bufferbloat-direction", "down", "Bufferbloat load: down, up, or both (reports download, upload and bidirectional bloat)")
+	uploadURL  = flag.String("upload-url", "", "URL that accepts POSTed data for -upload and upload bufferbloat (default: the backend's upload endpoint)")
+	upload     = flag.Bool("upload", false, "Measure upload speed for 10s and report the download:upload asymmetry")
+	asymWarn   = flag.Float64("asymmetry-warn", 10, "Flag a download:upload ratio above this as upload-bound")
+	maxConns   = flag.Int("max-conns-per-host", 0, "Cap connections per host, so extra download streams share them (0 is unlimited)")
+	maxIdle    = flag.Int("max-idle-per-host", 0, "Idle connections kept per host between requests (0 matches -downloads)")
+	idleTO     = flag.Duration("idle-timeout", 0, "Close pooled connections idle for this long (0 is the Go default of 90s)")
+	rateLimit  = flag.Float64("rate-limit", 0, "Cap requests per second across all phases, for servers that answer bursts with 429 (0 is unlimited)")
+	backoff429 = flag.Bool("backoff-429", false, "Pause all requests after a 429 Too Many Requests, for its Retry-After or a second")
 	stress     = flag.Bool("stress", false, "Stress mode (high concurrency)")
+	requests   = flag.Int("requests", 0, "End a -stress run after this many successful requests across all connections (0 runs for -timeout)")
 	p2p        = flag.String("p2p", "", "P2P mode: comma-separated list of URLs")
+	p2pWorkers = flag.Int("p2p-workers", 0, "Simultaneous P2P downloads; above the node count each node gets several streams (default one per node, at most 32)")
 	watch      = flag.Bool("watch", false, "Watchdog mode: continuous monitoring")
-	interval   = flag.Duration("interval", 5*time.Second, "Watchdog interval")
+	continuous = flag.Bool("continuous", false, "Repeat just the download test every -interval and print each speed with its change from the previous run")
+	count      = flag.Int("count", 0, "Stop -continuous after this many runs (0 runs until interrupted)")
+	interval   = flag.Duration("interval", 5*time.Second, "Watchdog and -continuous interval")
+	adaptive   = flag.Bool("interval-adaptive", false, "Shorten the watchdog interval while the link is degraded and lengthen it while healthy, within -interval-min and -interval-max")
+	intMin     = flag.Duration("interval-min", time.Second, "Shortest watchdog interval with -interval-adaptive")
+	intMax     = flag.Duration("interval-max", time.Minute, "Longest watchdog interval with -interval-adaptive")
+	align      = flag.Bool("align", false, "Align watchdog ticks to wall-clock multiples of -interval so hosts sample at the same instants")
+	intJitter  = flag.Float64("interval-jitter", 0, "Randomize each watchdog interval by up to this fraction, e.g. 0.2 for ±20% (0 disables)")
+	latSamples = flag.Int("latency-samples", 1, "Latency samples per watchdog tick; the median is displayed and alerted on")
+	loadGuard  = flag.Float64("load-guard", 0, "Skip watchdog ticks while the 1-minute load average per CPU is above this, e.g. 0.8 (Linux; 0 disables)")
+	tickRetry  = flag.Int("tick-retries", 1, "Retry a watchdog tick whose latency probe failed this many times before counting it as failed")
+	watchDur   = flag.Duration("watch-duration", 0, "Stop the watchdog and print the summary after this long (0 runs until interrupted)")
 	latThresh  = flag.Duration("latency-threshold", 100*time.Millisecond, "Latency alert threshold")
 	jitThresh  = flag.Duration("jitter-threshold", 15*time.Millisecond, "Jitter alert threshold")
 	lossThresh = flag.Float64("loss-threshold", 5.0, "Packet loss alert threshold (percent)")
+	bwThresh   = flag.Float64("bandwidth-threshold", 0, "Bandwidth alert threshold in Mbps for watchdog download probes (0 disables)")
+	bwEvery    = flag.Int("bandwidth-every", 0, "Run a small watchdog download probe every N ticks (default 10 when -bandwidth-threshold is set)")
+	alertsOut  = flag.String("alerts-out", "", "Append watchdog alerts as JSON lines to this file")
+	onAlert    = flag.String("on-alert", "", "Shell command to run for each watchdog alert; details are in PULSEGO_ALERT_* variables")
+	onAlertTO  = flag.Duration("on-alert-timeout", 10*time.Second, "Kill an -on-alert command that runs longer than this")
+	timeline   = flag.String("timeline-out", "", "Write a time series to this file: per 500ms of the download as CSV, or the watchdog's downsampled history as JSON lines when it stops")
+	plotOut    = flag.String("plot-out", "", "Write a tab-separated watchdog time series to this file for gnuplot or pandas")
+	baseSamp   = flag.Int("baseline-samples", 0, "Measure the first N watchdog ticks without alerting to establish a baseline latency and jitter")
+	relThresh  = flag.Bool("relative-thresholds", false, "Treat -latency-threshold and -jitter-threshold as margins above the -baseline-samples baseline")
+	smooth     = flag.Float64("smooth", 0, "Show a watchdog grade smoothed by an exponential moving average with this alpha (0-1, 0 disables)")
 	gaming     = flag.Bool("gaming", false, "Gaming mode: latency-focused monitoring (no bandwidth test)")
+	cacheTTL   = flag.Duration("cache-ttl", 0, "Reuse the last result for identical parameters within this window (0 disables)")
+	noCache    = flag.Bool("no-cache", false, "Ignore any cached result and run a fresh test")
+	force      = flag.Bool("force", false, "Alias for -no-cache")
+	maxErrRate = flag.Float64("max-error-rate", 1, "Fail the run when more than this fraction of download requests fail (0-1)")
+	userAgent  = flag.String("user-agent", "", "User-Agent header for all requests (default PulseGo/<version>)")
+	browserUA  = flag.Bool("browser-ua", false, "Send a common desktop Chrome User-Agent, for servers that block unknown clients")
+	useHTTP3   = flag.Bool("http3", false, "Send all requests over HTTP/3 (QUIC); requires a build with -tags http3")
+	dscp       = flag.String("dscp", "", "Mark every connection with this DSCP value, e.g. EF, CS6, AF41 or 0-63")
+	dnsFallbk  = flag.String("dns-fallback", httpclient.DefaultFallbackResolvers, "Resolvers (IP[:port], comma-separated) to retry with when the system resolver fails, e.g. 1.1.1.1,8.8.8.8 (default: none)")
+	noKeepAliv = flag.Bool("no-keepalive", false, "Open a new connection for every request (lowers throughput, raises latency)")
+	compress   = flag.Bool("allow-compression", false, "Accept gzip-encoded downloads (speed is still computed from wire bytes)")
+	loadedLat  = flag.Bool("loaded-latency", true, "Probe latency on a separate connection during the download")
+	owdHeader  = flag.String("owd-header", "", "Response header carrying the server's receive timestamp; enables one-way delay measurement")
+	direction  = flag.Bool("direction", false, "Compare a minimal GET with a 64KB POST to hint whether upstream or downstream is the bottleneck")
+	rcvWindow  = flag.String("rcv-window", "4MB", "Receive window assumed per TCP connection when checking whether one connection can fill the link")
+	strictTLS  = flag.Bool("strict-tls", false, "Check the server's TLS version, cipher suite and certificate, and fail the run on a violation")
+	tlsMin     = flag.String("tls-min-version", "1.2", "Lowest TLS version -strict-tls accepts: 1.0, 1.1, 1.2 or 1.3")
+	certWarn   = flag.Duration("cert-expiry-warn", 14*24*time.Hour, "With -strict-tls, fail when the certificate expires within this long")
+	histogram  = flag.Bool("histogram", false, "Report a latency histogram")
+	histBounds = flag.String("histogram-buckets", "10ms,25ms,50ms,100ms", "Upper bounds of the latency histogram buckets")
+	ports      = flag.String("ports", "", "Check port reachability, e.g. 443/tcp,3478/udp,host:25/tcp")
+	portTime   = flag.Duration("port-timeout", 3*time.Second, "Timeout per port check")
+	pingCount  = flag.Int("ping", 0, "Time N TCP handshakes to the target and report min/avg/max round trip, jitter and loss")
+	traceRoute = flag.Bool("traceroute", false, "Trace the route to the target host (Linux, IPv4)")
+	rawOut     = flag.String("raw-out", "", "Write every jitter latency sample to this CSV file")
+	histFile   = flag.String("history", "", "Record each run in this file and compare the result with recent runs to the same target")
+	histWindow = flag.Duration("history-window", 7*24*time.Hour, "How far back -history averages earlier runs")
+	gradeScale = flag.String("grade-scale", "letter", "Grade scale: letter, words, pass-fail, or path to a JSON scale definition")
+	selftest   = flag.Bool("selftest", false, "Measure PulseGo's own loopback throughput ceiling")
+	expectMbps = flag.Float64("expected-speed", 1000, "Link speed in Mbps the self-test should be able to exceed")
+	dual       = flag.Bool("dual", false, "Measure latency to the host over IPv4 and IPv6 and compare them")
+	dualDL     = flag.Bool("dual-download", false, "With -dual, also run the download over each family")
+	cmpBackend = flag.String("compare-backends", "", "Run the test against each of these backends in turn, e.g. tele2,cloudflare or all, and compare them")
+	explain    = flag.Bool("explain", false, "Show how the health score adds up: each component's bucket and points, and the grade bands")
+	reuseTest  = flag.Bool("reuse-test", false, "Compare download throughput over pooled keep-alive connections with a new connection per request")
+	sizeSweep  = flag.Bool("size-sweep", false, "Download 100KB, 1MB, 10MB and 100MB from the backend and tabulate throughput per size")
+	connTest   = flag.Int("connect-test", 0, "Open N fresh TCP connections to the target and report the success rate and failure reasons")
+	quickBW    = flag.Bool("quick-bw", false, "Estimate bandwidth from packet-pair dispersion instead of a full download (approximate, uses little data)")
+	apiAddr    = flag.String("api", "", "Serve on-demand tests over HTTP on this address, e.g. :8080; with -watch, serve the running watchdog's statistics instead")
+	readyGrade = flag.String("ready-grade", "", "With -api, the lowest grade of the last result at which GET /ready answers 200 (default: the better half of the grade scale)")
+	warmServe  = flag.String("warm-serve", "", "With -api, run a test at startup: sync (before listening) or pending (GET /last answers pending until it is done)")
+	compare    = flag.Bool("compare", false, "Compare two saved JSON results: -compare before.json after.json")
 )
 
 func main() {
+	started := time.Now()
+	if err := applyEnv(flag.CommandLine); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 	flag.Parse()
 
+	if *pprofAddr != "" {
+		if err := startPprof(*pprofAddr); err != nil {
+			fmt.Printf("Error: -pprof: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *compare {
+		runCompare()
+		return
+	}
+
+	if *listBack {
+		listBackends()
+		return
+	}
+
+	testBackend, err := selectBackend()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	*url = testBackend.DownloadURL(testBytes)
+
+	extraFormats, err = parseExtraFormats(*alsoFormat)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	selected, err = parseMetrics(*metricList)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	bundleDiagnostics()
+
+	if *expectSHA != "" {
+		*expectSHA = strings.ToLower(strings.TrimSpace(*expectSHA))
+		if _, err := hex.DecodeString(*expectSHA); err != nil || len(*expectSHA) != 64 {
+			fmt.Println("Error: -expect-sha256 must be 64 hexadecimal characters")
+			os.Exit(1)
+		}
+	}
+
+	if *strictTLS {
+		tlsPolicy.MinVersion, err = metrics.ParseTLSVersion(*tlsMin)
+		if err != nil {
+			fmt.Printf("Error: -tls-min-version: %v\n", err)
+			os.Exit(1)
+		}
+		tlsPolicy.ExpiryWarning = *certWarn
+		if !strings.HasPrefix(*url, "https://") {
+			fmt.Printf("Error: -strict-tls needs an https URL, and %s is plain http; use -backend cloudflare or an https -url\n", *url)
+			os.Exit(1)
+		}
+	}
+
+	bloatDirs, err = parseBloatDirection(*bloatDir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *uploadURL == "" {
+		*uploadURL = testBackend.UploadURL()
+	}
+	if selected["bufferbloat"] && needsUpload(bloatDirs) && *uploadURL == "" {
+		fmt.Printf("Error: -bufferbloat-direction %s needs an upload endpoint; the %s backend has none, so set -upload-url\n", *bloatDir, testBackend.Name())
+		os.Exit(1)
+	}
+
+	if *upload && *uploadURL == "" {
+		fmt.Printf("Error: -upload needs an upload endpoint; the %s backend has none, so set -upload-url\n", testBackend.Name())
+		os.Exit(1)
+	}
+
+	if *dataBudget != "" {
+		total, err := parseBytes(*dataBudget)
+		if err != nil {
+			fmt.Printf("Error: -data-budget: %v\n", err)
+			os.Exit(1)
+		}
+		budget = planBudget(total)
+		if w := budget.warning(); w != "" && *format == "text" {
+			fmt.Printf("Warning: %s\n", w)
+		}
+	}
+
+	windowBytes, err = parseBytes(*rcvWindow)
+	if err != nil {
+		fmt.Printf("Error: -rcv-window: %v\n", err)
+		os.Exit(1)
+	}
+
+	fields, err := output.ParseFields(*fieldList)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var dscpValue int
+	if *dscp != "" {
+		dscpValue, err = httpclient.ParseDSCP(*dscp)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	resolvers, err := httpclient.ParseResolvers(*dnsFallbk)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *warmServe {
+	case "", "sync", "pending":
+	default:
+		fmt.Printf("Error: invalid -warm-serve %q (want sync or pending)\n", *warmServe)
+		os.Exit(1)
+	}
+	if *warmServe != "" && *apiAddr == "" {
+		fmt.Println("Error: -warm-serve requires -api")
+		os.Exit(1)
+	}
+	if *readyGrade != "" && *apiAddr == "" {
+		fmt.Println("Error: -ready-grade requires -api")
+		os.Exit(1)
+	}
+	if *watch && (*warmServe != "" || *readyGrade != "") {
+		fmt.Println("Error: -warm-serve and -ready-grade do not apply to the -watch API")
+		os.Exit(1)
+	}
+
+	if *requests < 0 {
+		fmt.Println("Error: -requests must not be negative")
+		os.Exit(1)
+	}
+	if *requests > 0 && !*stress {
+		fmt.Println("Error: -requests requires -stress")
+		os.Exit(1)
+	}
+
+	if *rateLimit < 0 {
+		fmt.Println("Error: -rate-limit must not be negative")
+		os.Exit(1)
+	}
+	if *maxConns < 0 || *maxIdle < 0 || *idleTO < 0 {
+		fmt.Println("Error: -max-conns-per-host, -max-idle-per-host and -idle-timeout must not be negative")
+		os.Exit(1)
+	}
+	err = httpclient.Configure(httpclient.Options{
+		DisableKeepAlives: *noKeepAliv,
+		UserAgent:         requestUserAgent(),
+		HTTP3:             *useHTTP3,
+		DSCP:              dscpValue,
+		SmallProbes:       budget.total > 0,
+
+		MaxConnsPerHost:     *maxConns,
+		MaxIdleConnsPerHost: *maxIdle,
+		IdleConnTimeout:     *idleTO,
+
+		RateLimit:  *rateLimit,
+		Backoff429: *backoff429,
+
+		FallbackResolvers: resolvers,
+		Resolve:           pinned,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	scale, err := metrics.LoadGradeScale(*gradeScale)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var bounds []time.Duration
+	if *histogram {
+		bounds, err = metrics.ParseHistogramBounds(*histBounds)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var portSpecs []metrics.PortSpec
+	if *ports != "" {
+		portSpecs, err = metrics.ParsePortSpecs(*ports, hostOf(*url))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *watch {
+		runWatchdog(context.Background(), testBackend, scale, bounds)
+		return
+	}
+
+	if *continuous {
+		runContinuous(testBackend)
+		return
+	}
+
+	if *apiAddr != "" {
+		runAPI(*apiAddr, testBackend, scale, fields, bounds, portSpecs)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout*3)
 	defer cancel()
 
-	if *watch {
-		runWatchdog(ctx)
+	if *selftest {
+		runSelfTest(ctx)
+		return
+	}
+
+	if *quickBW {
+		runQuickBW(ctx)
+		return
+	}
+
+	if *connTest > 0 {
+		runConnectTest(ctx)
+		return
+	}
+
+	if *dual {
+		runDual(ctx)
+		return
+	}
+
+	if *sizeSweep {
+		runSizeSweep(ctx, testBackend)
+		return
+	}
+
+	if *reuseTest {
+		runReuseTest(testBackend)
+		return
+	}
+
+	if *cmpBackend != "" {
+		runCompareBackends(*cmpBackend)
 		return
 	}
 
-	if *format == "text" {
+	if progress() && !*noBanner {
 		fmt.Println("PulseGo - Network Health Monitor")
 		fmt.Println("==================================")
 	}
@@ -53,110 +396,860 @@ func main() {
 		return
 	}
 
-	latencyResult, _ := metrics.MeasureLatency(ctx, *url)
-	if *format == "text" && latencyResult != nil {
-		fmt.Printf("Latency: %v (TTFB: %v)\n", latencyResult.Latency, latencyResult.TTFB)
+	c := cache.New(*cacheTTL)
+	key := cacheKey()
+
+	if !*noCache && !*force && *bundle == "" {
+		if data, ts, ok := c.Get(key); ok {
+			var r output.Report
+			if err := json.Unmarshal(data, &r); err == nil {
+				if progress() {
+					fmt.Printf("Using cached result from %s (age %v, -force to refresh)\n",
+						ts.Format("15:04:05"), metrics.FormatDuration(time.Since(ts)))
+				}
+				r.Scale, r.Precision, r.Fields, r.Tags = scale, *precision, fields, tags
+				r.Explain = *explain
+				writeRawSamples(&r)
+				writeDownloadTimeline(&r)
+				report(&r)
+				return
+			}
+		}
 	}
 
-	engineCfg := engine.Config{
-		URL:        *url,
-		Downloads:  *downloads,
-		Timeout:    *timeout,
-		StressMode: *stress,
+	timer := newPhaseTimer(started)
+	timer.since("setup", started)
+	r, err := measure(ctx, testParams{URL: *url, Backend: testBackend.Name(), Downloads: *downloads, Progress: progress(), Timer: timer}, bounds, portSpecs)
+	if err != nil {
+		timer.print()
+		reportFailure(err)
+		os.Exit(1)
 	}
 
-	if *format == "text" {
-		if *stress {
-			fmt.Printf("Stress test (%d connections)...\n", *downloads)
-		} else {
-			fmt.Printf("Downloading (%d connections)...\n", *downloads)
+	if r.Download != nil && r.Download.ErrorRate > *maxErrRate {
+		r.Failure = fmt.Sprintf("%.0f%% of download requests failed (%d of %d), above -max-error-rate %.0f%%",
+			r.Download.ErrorRate*100, r.Download.Errors, r.Download.Requests, *maxErrRate*100)
+	} else if msg := verifyChecksum(r); msg != "" {
+		r.Failure = msg
+	} else if r.TLS != nil && len(r.TLS.Violations) > 0 {
+		r.Failure = "TLS policy violated: " + strings.Join(r.TLS.Violations, "; ")
+	} else if data, err := json.Marshal(r); err == nil {
+		if err := c.Put(key, data); err != nil && *format == "text" {
+			fmt.Printf("Warning: could not write cache: %v\n", err)
 		}
 	}
-	result, err := engine.Run(ctx, engineCfg)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+
+	recordHistory(r)
+
+	r.Scale, r.Precision, r.Fields, r.Tags = scale, *precision, fields, tags
+	r.Explain = *explain
+	writeRawSamples(r)
+	writeDownloadTimeline(r)
+	report(r)
+	saveBundle(r, nil, nil)
+	timer.print()
+	printRateLimitNote()
+
+	if r.Failure != "" {
 		os.Exit(1)
 	}
+}
 
-	if *simple {
-		fmt.Printf("%.2f Mbps\n", result.DownloadSpeed)
-		os.Exit(0)
+// printRateLimitNote says how much -rate-limit and -backoff-429 slowed the
+// run, since outside the latency probes the delays are inside the measured
+// times.
+func printRateLimitNote() {
+	n, waited, backoffs := httpclient.RateLimitStats()
+	if n == 0 || !progress() {
+		return
+	}
+	fmt.Printf("\nNote: rate limiting delayed %d requests by %s in total", n, metrics.FormatDuration(waited))
+	if backoffs > 0 {
+		fmt.Printf(", including %d backoffs after 429 responses", backoffs)
+	}
+	fmt.Println()
+}
+
+// reportFailure retraces the connection after a failed download so the
+// output shows how far it got instead of a bare error.
+func reportFailure(err error) {
+	if progress() {
+		fmt.Println("\nDownload failed, diagnosing connection...")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	d := metrics.Diagnose(ctx, *url, 10*time.Second)
+	fmt.Print(output.FormatFailure(err, d, *format, tags))
+	for _, extra := range extraFormats {
+		if err := os.WriteFile(extra.path, []byte(output.FormatFailure(err, d, extra.format, tags)), 0o644); err != nil {
+			fmt.Printf("Warning: could not write %s output: %v\n", extra.format, err)
+		}
+	}
+	saveBundle(nil, err, d)
+}
+
+// describeError explains a measurement failure by its category, falling
+// back to the error itself when it has none.
+func describeError(err error) string {
+	var e *metrics.Error
+	if !errors.As(err, &e) || e.Kind == nil {
+		return err.Error()
+	}
+	var hint string
+	switch e.Kind {
+	case metrics.ErrDNS:
+		hint = "the server's name could not be resolved; check the URL and your DNS settings"
+	case metrics.ErrConnRefused:
+		hint = "the server refused the connection; check the port, or the service may be down"
+	case metrics.ErrConnReset:
+		hint = "the connection was reset; a firewall or proxy may be interfering"
+	case metrics.ErrUnreachable:
+		hint = "the server is unreachable; check your network connection"
+	case metrics.ErrTLS:
+		hint = "the TLS handshake failed; the certificate may be invalid or the server may not speak TLS on this port"
+	case metrics.ErrTimeout:
+		hint = "the server did not answer in time; the link may be congested or the server overloaded"
+	default:
+		return err.Error()
+	}
+	return e.Op + ": " + hint
+}
+
+// verifyChecksum compares the downloads against -expect-sha256 and
+// describes the failure, if any. A body cut short by the timeout or the
+// data budget is not hashed, so at least one download must complete.
+func verifyChecksum(r *output.Report) string {
+	if *expectSHA == "" || r.Download == nil {
+		return ""
+	}
+	sums := r.Download.Checksums
+	if len(sums) == 0 {
+		return "no download completed, so its SHA-256 could not be verified; use a smaller file or a longer -timeout"
+	}
+	bad := 0
+	var got string
+	for _, sum := range sums {
+		if sum != *expectSHA {
+			bad++
+			got = sum
+		}
+	}
+	if bad > 0 {
+		return fmt.Sprintf("SHA-256 mismatch in %d of %d downloads: got %s, expected %s", bad, len(sums), got, *expectSHA)
+	}
+	return ""
+}
+
+func writeRawSamples(r *output.Report) {
+	if *rawOut == "" || r.Jitter == nil {
+		return
+	}
+
+	f, err := os.Create(*rawOut)
+	if err != nil {
+		fmt.Printf("Warning: could not write raw samples: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := output.WriteSamplesCSV(f, r.Jitter.Raw, true); err != nil {
+		fmt.Printf("Warning: could not write raw samples: %v\n", err)
+	}
+}
+
+// writeDownloadTimeline writes the -timeline-out CSV of a single test.
+func writeDownloadTimeline(r *output.Report) {
+	if *timeline == "" || r.Download == nil {
+		return
 	}
 
-	var jitterResult *metrics.JitterResult
-	var bbResult *metrics.BufferbloatResult
+	f, err := os.Create(*timeline)
+	if err != nil {
+		fmt.Printf("Warning: could not write timeline: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := output.WriteDownloadTimelineCSV(f, r); err != nil {
+		fmt.Printf("Warning: could not write timeline: %v\n", err)
+	}
+}
+
+func cacheKey() string {
+	return cache.Key(
+		*url,
+		strconv.Itoa(*downloads),
+		timeout.String(),
+		strconv.FormatBool(*jitter),
+		strconv.FormatBool(*bbloat),
+		*bloatDir,
+		*uploadURL,
+		strconv.FormatBool(*stress),
+		strconv.Itoa(*requests),
+		pinned.String(),
+		strconv.FormatBool(*simple),
+		strings.Join(selected.names(), ","),
+		*dataBudget,
+		*expectSHA,
+		strconv.FormatBool(*noKeepAliv),
+		strconv.Itoa(*maxConns),
+		strconv.Itoa(*maxIdle),
+		idleTO.String(),
+		strconv.FormatFloat(*rateLimit, 'g', -1, 64),
+		strconv.FormatBool(*backoff429),
+		strconv.FormatBool(*useHTTP3),
+		strconv.Itoa(httpclient.Current().DSCP),
+		requestUserAgent(),
+		strconv.FormatBool(*compress),
+		strconv.FormatBool(*loadedLat || *timeline != ""),
+		*owdHeader,
+		strconv.FormatBool(*direction),
+		strconv.FormatBool(*strictTLS),
+		strconv.FormatBool(*upload),
+		strconv.FormatFloat(*asymWarn, 'g', -1, 64),
+		*tlsMin,
+		certWarn.String(),
+		strconv.FormatBool(*histogram),
+		*histBounds,
+		*ports,
+		strconv.Itoa(*pingCount),
+		strconv.FormatBool(*traceRoute),
+	)
+}
+
+// tlsPolicy is what -strict-tls checks against.
+var tlsPolicy metrics.TLSPolicy
+
+// uploadDuration is how long -upload posts data.
+const uploadDuration = 10 * time.Second
 
-	if *jitter && !*stress {
-		if *format == "text" {
+// windowBytes is -rcv-window in bytes.
+var windowBytes int64
+
+// testBytes is the size of the file requested from a built-in backend.
+const testBytes = 10 << 20
+
+// testParams are the per-run settings that an API request may override.
+type testParams struct {
+	URL       string
+	Backend   string
+	Downloads int
+	Progress  bool
+	Timer     *phaseTimer
+}
+
+func measure(ctx context.Context, p testParams, bounds []time.Duration, portSpecs []metrics.PortSpec) (*output.Report, error) {
+	r := &output.Report{Stress: *stress, Methodology: methodology(p)}
+	received := httpclient.BytesReceived()
+
+	if p.Progress && *metricList != "" {
+		fmt.Printf("Metrics: %s\n", strings.Join(selected.names(), ", "))
+	}
+
+	if selected["latency"] {
+		start := time.Now()
+		var err error
+		r.Latency, err = metrics.MeasureLatency(ctx, p.URL)
+		p.Timer.since("latency", start)
+		if err != nil && *useHTTP3 {
+			return nil, fmt.Errorf("HTTP/3 request failed, the server may not support h3: %w", err)
+		}
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: %s\n", describeError(err))
+		}
+		if p.Progress && r.Latency != nil {
+			fmt.Printf("Latency: %s (TTFB: %s", metrics.FormatDuration(r.Latency.Latency), metrics.FormatDuration(r.Latency.TTFB))
+			if *useHTTP3 {
+				fmt.Printf(", %s", r.Latency.Protocol)
+			}
+			if conn := r.Latency.ConnState(); conn != "" {
+				fmt.Printf(", %s", conn)
+			}
+			fmt.Println(")")
+		}
+	}
+
+	if selected["download"] {
+		engineCfg := engine.Config{
+			URL:        p.URL,
+			Downloads:  p.Downloads,
+			Timeout:    *timeout,
+			StressMode: *stress,
+			Requests:   *requests,
+
+			AllowCompression: *compress,
+			ProbeLatency:     *loadedLat || *timeline != "",
+			MaxBytes:         budget.download,
+			Checksum:         *expectSHA != "",
+			MaxErrorRate:     *maxErrRate,
+		}
+
+		if p.Progress {
+			if *stress {
+				if *requests > 0 {
+					fmt.Printf("Stress test (%d connections, %d requests)...\n", max(p.Downloads, 10), *requests)
+				} else {
+					fmt.Printf("Stress test (%d connections)...\n", p.Downloads)
+				}
+			} else {
+				fmt.Printf("Downloading (%d connections)...\n", p.Downloads)
+			}
+		}
+		start := time.Now()
+		result, err := engine.Run(ctx, engineCfg)
+		p.Timer.since("download", start)
+		if err != nil {
+			return nil, err
+		}
+		r.Download = result
+	}
+
+	if *upload {
+		if p.Progress {
+			fmt.Printf("Uploading (%d connections)...\n", p.Downloads)
+		}
+		start := time.Now()
+		var err error
+		r.Upload, err = metrics.MeasureUpload(ctx, *uploadURL, p.Downloads, uploadDuration)
+		p.Timer.since("upload", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: upload: %v\n", err)
+		}
+		if r.Upload != nil && r.Download != nil {
+			r.Asymmetry = metrics.Asymmetry(r.Download.DownloadSpeed, r.Upload.Mbps)
+			r.Asymmetric = r.Asymmetry > *asymWarn
+		}
+	}
+
+	if *simple {
+		return r, nil
+	}
+
+	if selected["jitter"] {
+		if p.Progress {
 			fmt.Println("\nMeasuring Jitter...")
 		}
-		jitterResult, _ = metrics.MeasureJitter(ctx, *url, 10, 200*time.Millisecond)
+		start := time.Now()
+		var err error
+		r.Jitter, err = metrics.MeasureJitter(ctx, p.URL, 10, 200*time.Millisecond, bounds)
+		p.Timer.since("jitter", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: %s\n", describeError(err))
+		}
+	}
+
+	if selected["latency"] || selected["jitter"] {
+		start := time.Now()
+		r.MedianLatency = medianLatency(ctx, r, p.URL)
+		p.Timer.since("median latency", start)
 	}
 
-	if *bbloat && !*stress {
-		if *format == "text" {
+	if r.Download != nil {
+		rtt := r.MedianLatency
+		if t := r.Download.TCP; t != nil && t.RTT > 0 {
+			rtt = t.RTT
+		}
+		r.WindowLimit = metrics.CheckWindowLimit(windowBytes, rtt, r.Download.ConnectionSpeeds)
+	}
+
+	if *owdHeader != "" {
+		if p.Progress {
+			fmt.Println("\nMeasuring one-way delay...")
+		}
+		start := time.Now()
+		var err error
+		r.OneWay, err = metrics.MeasureOneWayDelay(ctx, p.URL, *owdHeader, 10)
+		p.Timer.since("one-way delay", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: one-way delay: %v\n", err)
+		}
+	}
+
+	if *strictTLS {
+		start := time.Now()
+		var err error
+		r.TLS, err = metrics.CheckTLS(ctx, p.URL, tlsPolicy, 10*time.Second)
+		p.Timer.since("tls check", start)
+		if err != nil {
+			r.TLS = &metrics.TLSResult{Violations: []string{"TLS check failed: " + err.Error()}}
+		}
+	}
+
+	if *direction {
+		if p.Progress {
+			fmt.Println("\nComparing upload and download timing...")
+		}
+		start := time.Now()
+		postURL := *uploadURL
+		if postURL == "" {
+			postURL = p.URL
+		}
+		var err error
+		r.Direction, err = metrics.MeasureDirection(ctx, p.URL, postURL, 10)
+		p.Timer.since("direction", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: direction probe: %v\n", err)
+		}
+	}
+
+	if selected["bufferbloat"] {
+		if p.Progress {
 			fmt.Println("\nMeasuring Bufferbloat...")
 		}
-		bbResult, _ = metrics.MeasureBufferbloat(ctx, *url)
+		start := time.Now()
+		results, err := metrics.MeasureBufferbloatDirections(ctx, p.URL, *uploadURL, bloatDirs, budget.bufferbloat)
+		p.Timer.since("bufferbloat", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: %s\n", describeError(err))
+		}
+		r.Bufferbloat = worstBloat(results)
+		if len(results) > 1 || bloatDirs[0] != metrics.BloatDown {
+			r.BufferbloatDirections = results
+		}
+	}
+
+	if len(portSpecs) > 0 {
+		if p.Progress {
+			fmt.Println("\nChecking ports...")
+		}
+		start := time.Now()
+		r.Ports = checkPorts(ctx, portSpecs)
+		p.Timer.since("ports", start)
+	}
+
+	if *pingCount > 0 {
+		if p.Progress {
+			fmt.Printf("\nPinging %s...\n", hostOf(p.URL))
+		}
+		start := time.Now()
+		var err error
+		r.Ping, err = metrics.Ping(ctx, p.URL, *pingCount, 200*time.Millisecond, 3*time.Second)
+		p.Timer.since("ping", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: ping: %v\n", err)
+		}
+	}
+
+	if *traceRoute {
+		if p.Progress {
+			fmt.Printf("\nTracing route to %s...\n", hostOf(p.URL))
+		}
+		start := time.Now()
+		var err error
+		r.Traceroute, err = metrics.Traceroute(ctx, p.URL, 30, 2*time.Second)
+		p.Timer.since("traceroute", start)
+		if err != nil && p.Progress {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if budget.total > 0 {
+		r.DataUsed = httpclient.BytesReceived() - received
+	}
+	r.DNSFallback = httpclient.FallbackAnswers()
+
+	return r, nil
+}
+
+// methodology records how a result is produced, so an archived JSON result
+// can be understood and reproduced.
+func methodology(p testParams) *output.Methodology {
+	m := &output.Methodology{
+		Backend:       p.Backend,
+		URL:           p.URL,
+		Connections:   p.Downloads,
+		Mode:          "standard",
+		Timeout:       timeout.String(),
+		Warmup:        "0s",
+		KeepAlive:     !*noKeepAliv,
+		Compression:   *compress,
+		HTTP3:         *useHTTP3,
+		Metrics:       selected.names(),
+		LoadedLatency: (*loadedLat || *timeline != "") && selected["download"],
+		Bufferbloat:   selected["bufferbloat"],
+		UserAgent:     requestUserAgent(),
+		Version:       httpclient.Version,
+	}
+	if m.UserAgent == "" {
+		m.UserAgent = httpclient.DefaultUserAgent()
+	}
+	m.DataBudget = budget.total
+	if m.Bufferbloat {
+		m.BufferbloatDirection = *bloatDir
+	}
+	if v := httpclient.Current().DSCP; v != 0 {
+		m.DSCP = httpclient.DSCPString(v)
+	}
+	if pins := httpclient.Current().Resolve; len(pins) > 0 {
+		m.Resolve = pins
+	}
+	if p.Backend != "custom" {
+		m.FileBytes = testBytes
+	}
+	if *stress {
+		m.Mode = "stress"
+		m.Connections = max(p.Downloads, 10)
+		m.Requests = *requests
+	}
+	if selected["jitter"] {
+		m.JitterSamples = 10
+		m.JitterInterval = (200 * time.Millisecond).String()
+	}
+	return m
+}
+
+// medianLatency reuses the jitter samples when there are any and otherwise
+// takes a few quick samples of its own, so a single slow first request
+// cannot drag the grade down.
+func medianLatency(ctx context.Context, r *output.Report, url string) time.Duration {
+	if r.Jitter != nil {
+		if m := metrics.MedianSampleLatency(r.Jitter.Raw); m > 0 {
+			return m
+		}
+	}
+
+	var samples []time.Duration
+	for i := 0; i < 5; i++ {
+		l, err := metrics.MeasureLatency(ctx, url)
+		if err != nil {
+			continue
+		}
+		samples = append(samples, l.Latency)
+	}
+	return metrics.Median(samples)
+}
+
+func checkPorts(ctx context.Context, specs []metrics.PortSpec) []*metrics.PortResult {
+	results := make([]*metrics.PortResult, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = metrics.CheckPort(ctx, spec.Host, spec.Port, spec.Proto, *portTime)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// selectBackend returns the -url as a custom backend when one was given,
+// and the -backend otherwise.
+func selectBackend() (backend.Backend, error) {
+	if *url != "" {
+		return backend.Custom(*url), nil
+	}
+	return backend.Get(*backendArg)
+}
+
+func listBackends() {
+	for _, name := range backend.Names() {
+		b, _ := backend.Get(name)
+		marker := " "
+		if name == backend.Default {
+			marker = "*"
+		}
+		fmt.Printf("%s %-12s %s\n", marker, name, b.DownloadURL(testBytes))
+	}
+	fmt.Println("\n* default. Use -backend NAME to select one, or -url for a custom server.")
+}
+
+// progress reports whether banners and progress lines should be printed.
+func progress() bool {
+	return *format == "text" && !*quiet
+}
+
+// requestUserAgent resolves -user-agent and -browser-ua; an explicit
+// -user-agent wins.
+func requestUserAgent() string {
+	if *userAgent != "" {
+		return *userAgent
+	}
+	if *browserUA {
+		return httpclient.BrowserUserAgent
+	}
+	return ""
+}
+
+func hostOf(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func report(r *output.Report) {
+	result := r.Download
+
+	if *simple {
+		fmt.Printf("%.2f Mbps\n", result.DownloadSpeed)
+		return
+	}
+
+	grade(r)
+
+	fmt.Print(render(r, *format))
+
+	for _, extra := range extraFormats {
+		if err := os.WriteFile(extra.path, []byte(render(r, extra.format)), 0o644); err != nil {
+			fmt.Printf("Warning: could not write %s output: %v\n", extra.format, err)
+		}
 	}
+}
 
-	var bloatStr string
-	if bbResult != nil {
-		bloatStr = bbResult.Severity
-	} else {
-		bloatStr = "Unknown"
+func grade(r *output.Report) {
+	bloatStr := "Unknown"
+	if r.Bufferbloat != nil {
+		bloatStr = r.Bufferbloat.Severity
 	}
 
-	var jitterDur time.Duration
-	var jitterLoss float64
-	if jitterResult != nil {
-		jitterDur = jitterResult.Jitter
-		jitterLoss = jitterResult.PacketLoss
+	latency := r.MedianLatency
+	if latency == 0 && r.Latency != nil {
+		latency = r.Latency.Latency
 	}
 
-	health := metrics.CalculateHealthScore(result.DownloadSpeed, jitterDur, latencyResult.Latency, bloatStr)
+	var mbps float64
+	if r.Download != nil {
+		mbps = r.Download.DownloadSpeed
+	}
+	r.Health = metrics.CalculateHealthScore(mbps, r.Jitter, latency, bloatStr, r.Scale)
+}
 
-	switch *format {
+type formatTarget struct {
+	format string
+	path   string
+}
+
+var extraFormats []formatTarget
+
+func parseExtraFormats(s string) ([]formatTarget, error) {
+	var targets []formatTarget
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f, path, ok := strings.Cut(part, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid -also-format entry %q, expected format=path", part)
+		}
+		switch f {
+		case "text", "json", "prometheus", "csv":
+		default:
+			return nil, fmt.Errorf("unknown format %q in -also-format", f)
+		}
+		targets = append(targets, formatTarget{format: f, path: path})
+	}
+	return targets, nil
+}
+
+func render(r *output.Report, f string) string {
+	switch f {
 	case "json":
-		fmt.Println(output.FormatJSON(
-			result.DownloadSpeed,
-			result.BytesReceived,
-			result.Duration,
-			result.Connections,
-			latencyResult.Latency,
-			jitterDur,
-			bbResult.BloatDelta,
-			jitterLoss,
-			bloatStr,
-			health.Grade,
-			health.Score,
-		))
+		return output.FormatJSON(r) + "\n"
 	case "prometheus":
-		fmt.Print(output.FormatPrometheus(
-			result.DownloadSpeed,
-			latencyResult.Latency,
-			jitterDur,
-			health.Score,
-			health.Grade,
-		))
+		return output.FormatPrometheus(r)
+	case "csv":
+		return output.FormatCSV(r)
 	default:
-		fmt.Printf("Download: %.2f Mbps | %.2f MB in %v\n",
-			result.DownloadSpeed,
-			float64(result.BytesReceived)/1_000_000,
-			result.Duration,
-		)
-		if *stress {
-			fmt.Printf("Connections: %d | Peak: %.2f Mbps | Errors: %d\n",
-				result.Connections, result.PeakSpeed, result.Errors)
+		return output.FormatText(r)
+	}
+}
+
+func runCompare() {
+	if flag.NArg() != 2 {
+		fmt.Println("Error: -compare requires two JSON result files")
+		os.Exit(1)
+	}
+
+	before, err := output.LoadJSON(flag.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	after, err := output.LoadJSON(flag.Arg(1))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(output.FormatComparison(before, after))
+}
+
+func runSelfTest(ctx context.Context) {
+	if progress() {
+		fmt.Printf("Self-test: %d connections against an in-process loopback server...\n", *downloads)
+	}
+
+	result, err := engine.SelfTest(ctx, 64<<20, *downloads, *timeout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Loopback: %.2f Mbps | %.2f MB in %v\n",
+		result.DownloadSpeed,
+		float64(result.BytesReceived)/1_000_000,
+		metrics.FormatDuration(result.Duration),
+	)
+
+	if result.DownloadSpeed < *expectMbps {
+		fmt.Printf("Warning: loopback throughput is below the expected link speed of %.0f Mbps; "+
+			"PulseGo itself will be the bottleneck on this machine\n", *expectMbps)
+		return
+	}
+	fmt.Printf("OK: PulseGo can measure links up to ~%.0f Mbps on this machine\n", result.DownloadSpeed)
+}
+
+var sweepSizes = []int64{100 << 10, 1 << 20, 10 << 20, 100 << 20}
+
+// runSizeSweep downloads a geometric series of sizes so the table shows
+// where small transfers stop being latency-bound and throughput levels off.
+func runSizeSweep(ctx context.Context, b backend.Backend) {
+	if b.Name() == "custom" {
+		fmt.Println("Error: -size-sweep needs a -backend that can serve different sizes, not a fixed -url")
+		os.Exit(1)
+	}
+
+	type sweepRow struct {
+		Size     string  `json:"size"`
+		Bytes    int64   `json:"bytes"`
+		Mbps     float64 `json:"mbps"`
+		Duration string  `json:"duration"`
+		Error    string  `json:"error,omitempty"`
+	}
+
+	var rows []sweepRow
+	for _, size := range sweepSizes {
+		label := formatSize(size)
+		if progress() {
+			fmt.Printf("Downloading %s (%d connections)...\n", label, *downloads)
 		}
-		if jitterResult != nil {
-			fmt.Printf("Jitter: %v | Min: %v | Max: %v | Loss: %.1f%%\n",
-				jitterResult.Jitter, jitterResult.MinLatency, jitterResult.MaxLatency, jitterResult.PacketLoss)
+
+		result, err := engine.Run(ctx, engine.Config{
+			URL:              b.DownloadURL(size),
+			Downloads:        *downloads,
+			Timeout:          *timeout,
+			AllowCompression: *compress,
+		})
+		row := sweepRow{Size: label}
+		if err != nil {
+			row.Error = err.Error()
+		} else {
+			row.Bytes = result.BytesReceived
+			row.Mbps = result.DownloadSpeed
+			row.Duration = output.RoundDuration(result.Duration).String()
 		}
-		if bbResult != nil {
-			fmt.Printf("Bufferbloat: %s (Delta %v)\n", bbResult.Severity, bbResult.BloatDelta)
+		rows = append(rows, row)
+	}
+
+	if *format == "json" {
+		data, _ := json.MarshalIndent(rows, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("\n%-8s %12s %12s %10s\n", "Size", "Bytes", "Mbps", "Time")
+	for _, row := range rows {
+		if row.Error != "" {
+			fmt.Printf("%-8s %s\n", row.Size, row.Error)
+			continue
 		}
-		fmt.Println("\n" + health.String())
+		fmt.Printf("%-8s %12d %12.2f %10s\n", row.Size, row.Bytes, row.Mbps, row.Duration)
+	}
+}
+
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%dGB", bytes>>30)
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%dMB", bytes>>20)
+	default:
+		return fmt.Sprintf("%dKB", bytes>>10)
+	}
+}
+
+func runQuickBW(ctx context.Context) {
+	if progress() {
+		fmt.Println("Estimating bandwidth from packet-pair dispersion...")
+	}
+
+	result, err := metrics.EstimateBandwidthPacketPair(ctx, *url)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *simple {
+		fmt.Printf("%.2f Mbps\n", result.Mbps)
+		return
+	}
+	if *format == "json" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"estimate_mbps": result.Mbps,
+			"confidence":    result.Confidence,
+			"samples":       result.Samples,
+			"bytes":         result.BytesUsed,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Estimated bandwidth: ~%.2f Mbps (confidence: %s, %d samples, %.2f MB used)\n",
+		result.Mbps, result.Confidence, result.Samples, float64(result.BytesUsed)/1_000_000)
+	fmt.Println("Packet-pair estimates are approximate; run without -quick-bw for a full measurement.")
+}
+
+func runConnectTest(ctx context.Context) {
+	if progress() {
+		fmt.Printf("Opening %d connections to %s...\n", *connTest, hostOf(*url))
+	}
+
+	result, err := metrics.ConnectTest(ctx, *url, *connTest, 50*time.Millisecond, 3*time.Second)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	reasons := make([]string, 0, len(result.Failures))
+	for reason := range result.Failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return result.Failures[reasons[i]] > result.Failures[reasons[j]] })
+
+	if *simple {
+		fmt.Printf("%.1f%%\n", result.SuccessRate())
+		return
+	}
+	if *format == "json" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"target":            result.Addr,
+			"attempts":          result.Attempts,
+			"successes":         result.Successes,
+			"success_rate":      result.SuccessRate(),
+			"failures":          result.Failures,
+			"connect_min_ms":    float64(result.Min) / float64(time.Millisecond),
+			"connect_median_ms": float64(result.Median) / float64(time.Millisecond),
+			"connect_max_ms":    float64(result.Max) / float64(time.Millisecond),
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Connect test: %d/%d succeeded (%.1f%%) to %s\n",
+		result.Successes, result.Attempts, result.SuccessRate(), result.Addr)
+	if result.Successes > 0 {
+		fmt.Printf("Connect time: Min: %v | Median: %v | Max: %v\n",
+			metrics.FormatDuration(result.Min), metrics.FormatDuration(result.Median), metrics.FormatDuration(result.Max))
+	}
+	if len(reasons) > 0 {
+		fmt.Println("Failures:")
+	}
+	for _, reason := range reasons {
+		fmt.Printf("  %-12s %d\n", reason, result.Failures[reason])
 	}
 }
 
@@ -166,9 +1259,11 @@ func runP2P(ctx context.Context) {
 		targets[i] = strings.TrimSpace(targets[i])
 	}
 
-	fmt.Printf("P2P test with %d nodes...\n", len(targets))
+	if progress() {
+		fmt.Printf("P2P test with %d nodes...\n", len(targets))
+	}
 
-	result, err := engine.RunP2P(ctx, targets, *timeout)
+	result, err := engine.RunP2P(ctx, targets, *timeout, *p2pWorkers)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -179,34 +1274,162 @@ func runP2P(ctx context.Context) {
 		return
 	}
 
-	fmt.Printf("P2P Download: %.2f Mbps | %.2f MB in %v\n",
+	fmt.Printf("P2P Download: %.2f Mbps average | %.2f Mbps aggregate peak | %.2f MB in %s\n",
 		result.DownloadSpeed,
+		result.PeakSpeed,
 		float64(result.BytesReceived)/1_000_000,
-		result.Duration,
+		metrics.FormatDuration(result.Duration),
 	)
-	fmt.Printf("Nodes: %d | Errors: %d\n", result.Connections, result.Errors)
+	fmt.Printf("Nodes: %d | Dead: %d | Workers: %d", len(result.Nodes), result.Errors, result.Connections)
+	if per := result.Connections / len(result.Nodes); per > 1 {
+		fmt.Printf(" (%d streams per node)", per)
+	}
+	fmt.Println()
+
+	// Rank the nodes fastest first; dead nodes sort last since their speed
+	// is zero.
+	nodes := result.Nodes
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Speed > nodes[j].Speed })
+
+	fmt.Printf("\n%-10s %10s %12s %10s %9s  %s\n", "Status", "Mbps", "Bytes", "Latency", "Attempts", "URL")
+	for _, n := range nodes {
+		fmt.Printf("%-10s %10.2f %12d %10v %9d  %s\n",
+			n.Status, n.Speed, n.Bytes, metrics.FormatDuration(n.Latency), n.Attempts, n.URL)
+		if n.Error != "" {
+			fmt.Printf("%-10s %s\n", "", n.Error)
+		}
+	}
 }
 
-func runWatchdog(ctx context.Context) {
+func runWatchdog(ctx context.Context, b backend.Backend, scale metrics.GradeScale, bounds []time.Duration) {
 	watchURL := *url
-	if *gaming || strings.Contains(watchURL, "10MB.zip") {
-		watchURL = "http://speedtest.tele2.net/1MB.zip"
+	if *gaming || b.Name() != "custom" {
+		watchURL = b.DownloadURL(1 << 20)
 	}
 
 	cfg := watchdog.Config{
 		URL:              watchURL,
 		Interval:         *interval,
+		IntervalJitter:   *intJitter,
+		Align:            *align,
+		Duration:         *watchDur,
+		LatencySamples:   *latSamples,
+		TickRetries:      *tickRetry,
 		JitterSamples:    5,
 		JitterInterval:   100 * time.Millisecond,
 		JitterThreshold:  *jitThresh,
 		LatencyThreshold: *latThresh,
 		LossThreshold:    *lossThresh,
 		GamingMode:       *gaming,
+		GradeScale:       scale,
+		HistogramBounds:  bounds,
+
+		BandwidthEvery:     *bwEvery,
+		BandwidthThreshold: *bwThresh,
+
+		SmoothAlpha: *smooth,
+
+		BaselineSamples:    *baseSamp,
+		RelativeThresholds: *relThresh,
+
+		OnAlert:        *onAlert,
+		OnAlertTimeout: *onAlertTO,
+
+		LoadGuard: *loadGuard,
+		NoBanner:  *noBanner || *quiet,
+	}
+	if cfg.BandwidthThreshold > 0 && cfg.BandwidthEvery == 0 {
+		cfg.BandwidthEvery = 10
 	}
 
+	if *smooth < 0 || *smooth > 1 {
+		fmt.Println("Error: -smooth must be between 0 and 1")
+		os.Exit(1)
+	}
+	if *adaptive {
+		if *intMin <= 0 || *intMax < *intMin {
+			fmt.Println("Error: -interval-min must be above 0 and no longer than -interval-max")
+			os.Exit(1)
+		}
+		if *align {
+			fmt.Println("Error: -interval-adaptive and -align are mutually exclusive")
+			os.Exit(1)
+		}
+		cfg.AdaptiveMin, cfg.AdaptiveMax = *intMin, *intMax
+	}
+	if *align && *intJitter > 0 {
+		fmt.Println("Error: -align and -interval-jitter are mutually exclusive")
+		os.Exit(1)
+	}
+	if *loadGuard < 0 {
+		fmt.Println("Error: -load-guard must not be negative")
+		os.Exit(1)
+	}
+	if *tickRetry < 0 {
+		fmt.Println("Error: -tick-retries must not be negative")
+		os.Exit(1)
+	}
+	if *baseSamp < 0 {
+		fmt.Println("Error: -baseline-samples must not be negative")
+		os.Exit(1)
+	}
+	if *relThresh && *baseSamp == 0 {
+		fmt.Println("Error: -relative-thresholds requires -baseline-samples")
+		os.Exit(1)
+	}
+	if *intJitter < 0 || *intJitter >= 1 {
+		fmt.Println("Error: -interval-jitter must be at least 0 and below 1")
+		os.Exit(1)
+	}
+
+	if *rawOut != "" {
+		f, err := os.Create(*rawOut)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.RawSamples = f
+	}
+
+	if *plotOut != "" {
+		f, err := os.Create(*plotOut)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.PlotOut = f
+	}
+
+	if *timeline != "" {
+		f, err := os.Create(*timeline)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.TimelineOut = f
+	}
+
+	if *alertsOut != "" {
+		f, err := os.OpenFile(*alertsOut, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.AlertsOut = f
+	}
+
+	// The watcher closes the output files, flushing them along with any
+	// queued alert hooks before the summary is printed.
 	w := watchdog.NewWatcher(cfg)
+	if *apiAddr != "" {
+		serveWatch(*apiAddr, w)
+	}
 
-	if err := w.Start(ctx); err != nil && err != context.Canceled {
+	err := w.Start(ctx)
+	if cerr := w.Close(); cerr != nil {
+		fmt.Printf("\nWarning: %v\n", cerr)
+	}
+	if err != nil && err != context.Canceled {
 		fmt.Printf("\nError: %v\n", err)
 		os.Exit(1)
 	}
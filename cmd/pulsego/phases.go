@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// metricNames are the measurement phases -metrics can select, in the order
+// they run.
+var metricNames = []string{"latency", "download", "jitter", "bufferbloat"}
+
+// phases is the set of measurement phases a run performs.
+type phases map[string]bool
+
+// selected holds the phases chosen on the command line.
+var selected phases
+
+// bloatDirs are the bufferbloat load directions to measure, in order.
+var bloatDirs []string
+
+// parseMetrics returns the phases named in s. An empty s keeps the
+// behaviour of the individual flags: latency and download always run, and
+// jitter and bufferbloat unless disabled or in stress mode. A -bundle run
+// selects every phase instead. -simple only reports the download, so it
+// never runs jitter or bufferbloat.
+func parseMetrics(s string) (phases, error) {
+	ph := phases{}
+	if s == "" && *bundle != "" {
+		for _, m := range metricNames {
+			ph[m] = true
+		}
+	} else if s == "" {
+		ph["latency"] = true
+		ph["download"] = true
+		ph["jitter"] = *jitter && !*stress
+		ph["bufferbloat"] = *bbloat && !*stress
+	} else {
+		for _, name := range strings.Split(s, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !isMetric(name) {
+				return nil, fmt.Errorf("unknown metric %q (valid: %s)", name, strings.Join(metricNames, ", "))
+			}
+			ph[name] = true
+		}
+	}
+
+	if *simple {
+		if !ph["download"] {
+			return nil, fmt.Errorf("-simple reports the download speed, so -metrics must include download")
+		}
+		ph["jitter"], ph["bufferbloat"] = false, false
+	}
+	return ph, nil
+}
+
+func isMetric(name string) bool {
+	for _, m := range metricNames {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// names lists the selected phases in the order they run.
+func (ph phases) names() []string {
+	var names []string
+	for _, m := range metricNames {
+		if ph[m] {
+			names = append(names, m)
+		}
+	}
+	return names
+}
+
+// parseBloatDirection maps -bufferbloat-direction to the loads to measure.
+// "both" measures each direction on its own as well as both together, so
+// the report can tell which side of the link bloats.
+func parseBloatDirection(s string) ([]string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case metrics.BloatDown:
+		return []string{metrics.BloatDown}, nil
+	case metrics.BloatUp:
+		return []string{metrics.BloatUp}, nil
+	case metrics.BloatBoth:
+		return []string{metrics.BloatDown, metrics.BloatUp, metrics.BloatBoth}, nil
+	}
+	return nil, fmt.Errorf("unknown -bufferbloat-direction %q (valid: down, up, both)", s)
+}
+
+func needsUpload(dirs []string) bool {
+	for _, d := range dirs {
+		if d != metrics.BloatDown {
+			return true
+		}
+	}
+	return false
+}
+
+// worstBloat returns the result with the largest latency increase, which
+// is the one the health grade is based on.
+func worstBloat(results []*metrics.BufferbloatResult) *metrics.BufferbloatResult {
+	var worst *metrics.BufferbloatResult
+	for _, r := range results {
+		if worst == nil || r.BloatDelta > worst.BloatDelta {
+			worst = r
+		}
+	}
+	return worst
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// resolveFlag collects repeated -resolve host:ip overrides, like curl's
+// --resolve. A comma-separated list is accepted too; a repeated host keeps
+// its last address.
+type resolveFlag map[string]string
+
+func (r resolveFlag) String() string {
+	hosts := make([]string, 0, len(r))
+	for h := range r {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	pairs := make([]string, len(hosts))
+	for i, h := range hosts {
+		pairs[i] = h + ":" + r[h]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (r resolveFlag) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		host, ip, err := httpclient.ParseResolve(part)
+		if err != nil {
+			return err
+		}
+		r[host] = ip
+	}
+	return nil
+}
+
+var pinned = resolveFlag{}
+
+func init() {
+	flag.Var(pinned, "resolve", "Connect to this IP for a host instead of resolving it, as host:ip, keeping the name for TLS and Host (repeatable)")
+}
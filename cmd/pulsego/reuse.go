@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/backend"
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// reuseBytes is the object size -reuse-test fetches from a built-in
+// backend: small enough that connection setup is a large share of each
+// request, as with the many small transfers of a web page.
+const reuseBytes = 100 << 10
+
+// reuseDuration is how long each half of -reuse-test runs.
+const reuseDuration = 5 * time.Second
+
+type reuseRun struct {
+	Mbps        float64 `json:"mbps"`
+	Requests    int     `json:"requests"`
+	PerSecond   float64 `json:"requests_per_second"`
+	Connections int     `json:"connections"`
+	Error       string  `json:"error,omitempty"`
+
+	// perRequest is how long each request took on its connection.
+	perRequest time.Duration
+}
+
+// runReuseTest fetches the same small object over and over for
+// reuseDuration, first over pooled keep-alive connections and then with a
+// new connection for every request, and reports what connection setup
+// costs on this link. It uses the stress engine, whose workers loop on
+// requests, with the shared transport switched between the two settings.
+func runReuseTest(b backend.Backend) {
+	target := *url
+	if b.Name() != "custom" {
+		target = b.DownloadURL(reuseBytes)
+	}
+
+	base := httpclient.Current()
+	defer httpclient.Configure(base)
+
+	modes := []struct {
+		name, desc string
+		fresh      bool
+	}{
+		{"pooled", "over pooled keep-alive connections", false},
+		{"fresh-conn", "with a new connection per request", true},
+	}
+	runs := make([]*reuseRun, len(modes))
+	for i, m := range modes {
+		if progress() {
+			fmt.Printf("Downloading for %v %s...\n", reuseDuration, m.desc)
+		}
+		opts := base
+		opts.DisableKeepAlives = m.fresh
+		runs[i] = &reuseRun{}
+		if err := httpclient.Configure(opts); err != nil {
+			runs[i].Error = err.Error()
+			continue
+		}
+		result, err := engine.Run(context.Background(), engine.Config{
+			URL:              target,
+			Downloads:        *downloads,
+			Timeout:          reuseDuration,
+			StressMode:       true,
+			AllowCompression: *compress,
+		})
+		if err != nil {
+			runs[i].Error = err.Error()
+			continue
+		}
+		runs[i].Mbps = result.DownloadSpeed
+		runs[i].Requests = result.Requests
+		runs[i].Connections = result.Connections
+		runs[i].PerSecond = float64(result.Requests) / result.Duration.Seconds()
+		if result.Requests > 0 {
+			runs[i].perRequest = result.Duration * time.Duration(result.Connections) / time.Duration(result.Requests)
+		}
+	}
+	pooled, fresh := runs[0], runs[1]
+
+	var penalty float64
+	var extra time.Duration
+	if pooled.Error == "" && fresh.Error == "" && pooled.Mbps > 0 {
+		penalty = (pooled.Mbps - fresh.Mbps) / pooled.Mbps * 100
+		extra = fresh.perRequest - pooled.perRequest
+	}
+
+	if *format == "json" {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"url":                  target,
+			"pooled":               pooled,
+			"fresh_conn":           fresh,
+			"penalty_percent":      penalty,
+			"extra_per_request_ms": float64(extra) / float64(time.Millisecond),
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	for i, r := range runs {
+		if r.Error != "" {
+			fmt.Printf("%s: %s\n", modes[i].name, r.Error)
+			continue
+		}
+		fmt.Printf("%s: %.2f Mbps (%d requests, %.1f/s)\n", modes[i].name, r.Mbps, r.Requests, r.PerSecond)
+	}
+	switch {
+	case pooled.Error != "" || fresh.Error != "":
+	case penalty > 0:
+		fmt.Printf("New connections cost %.0f%% of the throughput, about %s of connection setup per request\n",
+			penalty, metrics.FormatDuration(extra))
+	default:
+		fmt.Println("New connections cost no measurable throughput on this link")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+
+	"github.com/LoboGuardian/pulsego/internal/output"
+)
+
+// tagFlag collects repeated -tag key=value pairs. A comma-separated list is
+// accepted too so PULSEGO_TAG can carry several tags; a repeated key keeps
+// its last value.
+type tagFlag map[string]string
+
+func (t tagFlag) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + t[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (t tagFlag) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, err := output.ParseTag(part)
+		if err != nil {
+			return err
+		}
+		t[key] = value
+	}
+	return nil
+}
+
+var tags = tagFlag{}
+
+func init() {
+	flag.Var(tags, "tag", "Attach a key=value label to prometheus and json output (repeatable)")
+}
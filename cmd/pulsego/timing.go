@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// phaseTimer records how long each phase of a run took, for -timing. It
+// profiles PulseGo itself, not the network. A nil timer records nothing.
+type phaseTimer struct {
+	start  time.Time
+	phases []phaseTime
+}
+
+type phaseTime struct {
+	name string
+	took time.Duration
+}
+
+func newPhaseTimer(start time.Time) *phaseTimer {
+	if !*timing {
+		return nil
+	}
+	return &phaseTimer{start: start}
+}
+
+// since records the phase name as having run from start until now.
+func (t *phaseTimer) since(name string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.phases = append(t.phases, phaseTime{name, time.Since(start)})
+}
+
+// print writes the breakdown. Machine-readable formats get it on stderr
+// so their output stays parseable.
+func (t *phaseTimer) print() {
+	if t == nil {
+		return
+	}
+	var w io.Writer = os.Stdout
+	if *format != "text" {
+		w = os.Stderr
+	}
+
+	total := time.Since(t.start)
+	fmt.Fprintln(w, "\nTiming:")
+	for _, p := range t.phases {
+		fmt.Fprintf(w, "  %-14s %10v %5.1f%%\n", p.name, metrics.FormatDuration(p.took), float64(p.took)/float64(total)*100)
+	}
+	fmt.Fprintf(w, "  %-14s %10v\n", "total", metrics.FormatDuration(total))
+}
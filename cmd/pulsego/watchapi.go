@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/LoboGuardian/pulsego/internal/watchdog"
+)
+
+// serveWatch serves the aggregates and downsampled timeline of a running
+// watchdog for -watch -api, with a dashboard at /, so they can be read
+// without waiting for the summary.
+// It listens before returning, so a bad address fails the run up front.
+func serveWatch(addr string, w *watchdog.Watcher) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, _ := json.MarshalIndent(w.Stats.Snapshot().Export(), "", "  ")
+		writeJSON(rw, http.StatusOK, append(data, '\n'))
+	})
+	mux.HandleFunc("/timeline", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		buckets := w.Timeline()
+		if buckets == nil {
+			buckets = []watchdog.TimelineBucket{}
+		}
+		data, _ := json.MarshalIndent(buckets, "", "  ")
+		writeJSON(rw, http.StatusOK, append(data, '\n'))
+	})
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(rw, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rw.Header().Set("Allow", http.MethodGet)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		http.ServeFileFS(rw, r, dashboard, "web/watch.html")
+	})
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			fmt.Printf("\nWarning: watchdog API stopped: %v\n", err)
+		}
+	}()
+}
@@ -1,3 +1,17 @@
 module github.com/LoboGuardian/pulsego
 
 go 1.25.7
+
+require (
+	github.com/quic-go/quic-go v0.61.0
+	go.uber.org/goleak v1.3.0
+	golang.org/x/time v0.15.0
+)
+
+require (
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
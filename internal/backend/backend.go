@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Backend is a public test service. DownloadURL returns a URL that serves
+// roughly the requested number of bytes; UploadURL accepts a POSTed body,
+// or is empty when the service has no upload endpoint.
+type Backend interface {
+	Name() string
+	DownloadURL(bytes int64) string
+	UploadURL() string
+}
+
+// Default is the backend used when neither -backend nor -url is given.
+const Default = "tele2"
+
+var registry = map[string]Backend{}
+
+func Register(b Backend) {
+	registry[b.Name()] = b
+}
+
+func Get(name string) (Backend, error) {
+	b, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return b, nil
+}
+
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Custom wraps a user-supplied URL, which is served whatever size is asked
+// for.
+func Custom(url string) Backend {
+	return custom(url)
+}
+
+type custom string
+
+func (c custom) Name() string                   { return "custom" }
+func (c custom) DownloadURL(bytes int64) string { return string(c) }
+func (c custom) UploadURL() string              { return "" }
@@ -0,0 +1,48 @@
+package backend
+
+import "fmt"
+
+func init() {
+	Register(tele2{})
+	Register(cloudflare{})
+}
+
+// tele2 serves fixed-size files, so a request is rounded up to the next
+// one available.
+type tele2 struct{}
+
+var tele2Files = []struct {
+	bytes int64
+	name  string
+}{
+	{100 << 10, "100KB"},
+	{1 << 20, "1MB"},
+	{10 << 20, "10MB"},
+	{100 << 20, "100MB"},
+	{1 << 30, "1GB"},
+}
+
+func (tele2) Name() string { return "tele2" }
+
+func (tele2) DownloadURL(bytes int64) string {
+	name := tele2Files[len(tele2Files)-1].name
+	for _, f := range tele2Files {
+		if f.bytes >= bytes {
+			name = f.name
+			break
+		}
+	}
+	return "http://speedtest.tele2.net/" + name + ".zip"
+}
+
+func (tele2) UploadURL() string { return "http://speedtest.tele2.net/upload.php" }
+
+type cloudflare struct{}
+
+func (cloudflare) Name() string { return "cloudflare" }
+
+func (cloudflare) DownloadURL(bytes int64) string {
+	return fmt.Sprintf("https://speed.cloudflare.com/__down?bytes=%d", bytes)
+}
+
+func (cloudflare) UploadURL() string { return "https://speed.cloudflare.com/__up" }
@@ -2,11 +2,13 @@ package engine
 
 import (
 	"context"
-	"fmt"
-	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
 )
 
 type Config struct {
@@ -15,6 +17,31 @@ type Config struct {
 	Timeout    time.Duration
 	ChunkSize  int
 	StressMode bool
+
+	SampleInterval time.Duration
+	StallThreshold time.Duration
+
+	AllowCompression bool
+
+	// ProbeLatency runs a light latency probe on a separate connection
+	// while the download runs and reports it as Result.LoadedLatency.
+	ProbeLatency bool
+
+	// MaxBytes, when above 0, ends the download once that many bytes have
+	// arrived across all connections; Result.Capped reports it.
+	MaxBytes int64
+
+	// Checksum hashes every response body with SHA-256 as it is read;
+	// Result.Checksums lists the hashes of those read to the end.
+	Checksum bool
+
+	// Requests, when above 0, ends a stress run once that many requests
+	// have succeeded across all workers, with Timeout as the upper bound.
+	// The run also ends early once at least Requests have been attempted
+	// and more than MaxErrorRate of them failed, as it would then fail
+	// anyway; 0 leaves that to the Timeout.
+	Requests     int
+	MaxErrorRate float64
 }
 
 type Result struct {
@@ -25,6 +52,63 @@ type Result struct {
 	AvgSpeed      float64
 	PeakSpeed     float64
 	Errors        int
+	Requests      int
+	ErrorRate     float64
+
+	TimeToLastByte time.Duration
+	StallCount     int
+	LongestStall   time.Duration
+	RampTime       time.Duration
+	LoadedLatency  time.Duration
+
+	DecompressedBytes int64
+
+	// UnknownLength is set when the server sent no Content-Length, so the
+	// download ran until the end of the stream or the timeout.
+	UnknownLength bool
+	Capped        bool
+
+	// Checksums holds the hex SHA-256 of each response body that was read
+	// completely, when Config.Checksum is set.
+	Checksums []string
+
+	// TCP holds kernel socket statistics for the download connections, or
+	// is nil where TCP_INFO is unavailable.
+	TCP *TCPStats
+
+	ConnectionSpeeds []float64
+
+	// Nodes holds the per-target results of a P2P run.
+	Nodes []NodeResult
+
+	// Throughput is the rate of each SampleInterval of the download, and
+	// LoadedSamples the round trips of the ProbeLatency probes, in time
+	// order.
+	Throughput    []RateSample
+	LoadedSamples []LatencySample
+}
+
+// RateSample is the download throughput over the interval ending at Time.
+type RateSample struct {
+	Time time.Time
+	Mbps float64
+}
+
+// LatencySample is one loaded-latency probe, sent at Time.
+type LatencySample struct {
+	Time time.Time
+	RTT  time.Duration
+}
+
+// TCPStats sums the kernel retransmit counters of a run's connections and
+// averages their smoothed RTT and RTT variance. Retransmits are segments
+// this host sent again, so a download mostly shows the server's losses in
+// its RTT rather than here.
+type TCPStats struct {
+	Connections int
+	Retransmits int
+	RTT         time.Duration
+	RTTVar      time.Duration
 }
 
 type streamResult struct {
@@ -34,84 +118,281 @@ type streamResult struct {
 }
 
 func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.SampleInterval <= 0 {
+		cfg.SampleInterval = 100 * time.Millisecond
+	}
+	if cfg.StallThreshold <= 0 {
+		cfg.StallThreshold = 500 * time.Millisecond
+	}
+	if !cfg.ProbeLatency {
+		return run(ctx, cfg)
+	}
+
+	stop := make(chan struct{})
+	loaded := make(chan []LatencySample, 1)
+	go probeLoaded(ctx, cfg.URL, stop, loaded)
+
+	result, err := run(ctx, cfg)
+	close(stop)
+	samples := <-loaded
+	if err != nil {
+		return nil, err
+	}
+	rtts := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		rtts[i] = s.RTT
+	}
+	result.LoadedLatency = metrics.Median(rtts)
+	result.LoadedSamples = samples
+	return result, nil
+}
+
+func run(ctx context.Context, cfg Config) (*Result, error) {
 	if cfg.StressMode {
 		return runStress(ctx, cfg)
 	}
 	return runStandard(ctx, cfg)
 }
 
+// sharedWindow finds the stretch of a run during which every connection
+// was receiving: from the moment the last one got its response to the
+// moment the first one finished. The link is shared by all of them then,
+// so the bytes counted across it over its length are the aggregate rate,
+// unaffected by connections that started late or straggled at the end.
+type sharedWindow struct {
+	t     *transfer
+	conns int
+
+	mu      sync.Mutex
+	started int
+	from    time.Time
+	to      time.Time
+	fromB   int64
+	toB     int64
+	closed  bool
+}
+
+// open records that a connection got its response and is about to read.
+func (w *sharedWindow) open() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.started++
+	if w.started == w.conns && !w.closed {
+		w.from, w.fromB = time.Now(), w.t.bytes.Load()
+	}
+}
+
+// close records that a connection stopped reading. Only the first call
+// counts: a connection that ends before the last one opens leaves no
+// window at all.
+func (w *sharedWindow) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	if w.started == w.conns {
+		w.to, w.toB = time.Now(), w.t.bytes.Load()
+	}
+}
+
+// rate returns the aggregate rate over the window, or false when there was
+// none, as when a connection failed or finished before another started.
+func (w *sharedWindow) rate() (float64, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.to.IsZero() || !w.to.After(w.from) || w.toB == w.fromB {
+		return 0, false
+	}
+	return mbps(w.toB-w.fromB, w.to.Sub(w.from)), true
+}
+
 func runStandard(ctx context.Context, cfg Config) (*Result, error) {
 	client := &http.Client{
-		Timeout: cfg.Timeout,
-		Transport: &http.Transport{
-			MaxIdleConns:        cfg.Downloads,
-			MaxIdleConnsPerHost: cfg.Downloads,
-		},
+		Timeout:   cfg.Timeout,
+		Transport: httpclient.NewTransport(cfg.Downloads),
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	start := time.Now()
 	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var totalBytes int64
-	var errors int
+	var errors atomic.Int64
+	t := &transfer{maxBytes: cfg.MaxBytes, stop: cancel, checksum: cfg.Checksum}
 
-	download := func() {
+	stop := make(chan struct{})
+	stalls := make(chan watchStats, 1)
+	go t.watch(cfg.SampleInterval, cfg.StallThreshold, stop, stalls)
+
+	speeds := make([]float64, cfg.Downloads)
+	window := &sharedWindow{t: t, conns: cfg.Downloads}
+
+	download := func(i int) {
 		defer wg.Done()
-		req, err := http.NewRequestWithContext(ctx, "GET", cfg.URL, nil)
+		connStart := time.Now()
+		reqCtx, conn := traceConn(ctx)
+		req, err := httpclient.NewRequest(reqCtx, "GET", cfg.URL)
 		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
+			errors.Add(1)
 			return
 		}
+		req.Header.Set("Accept-Encoding", acceptEncoding(cfg.AllowCompression))
 
 		resp, err := client.Do(req)
 		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
+			if !t.capped.Load() {
+				errors.Add(1)
+			}
 			return
 		}
 		defer resp.Body.Close()
-
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
+		if resp.StatusCode >= 400 {
+			t.reject(resp)
+			errors.Add(1)
 			return
 		}
 
-		mu.Lock()
-		totalBytes += int64(len(data))
-		mu.Unlock()
+		window.open()
+		n, err := t.read(resp)
+		window.close()
+		t.sampleTCP(*conn)
+		if n > 0 {
+			speeds[i] = mbps(n, time.Since(connStart))
+		}
+		if err != nil && !endOfStream(resp, n, err) && !t.capped.Load() {
+			errors.Add(1)
+			return
+		}
 	}
 
 	wg.Add(cfg.Downloads)
 	for i := 0; i < cfg.Downloads; i++ {
-		go download()
+		go download(i)
 	}
 
 	wg.Wait()
 	duration := time.Since(start)
+	close(stop)
+	st := <-stalls
 
+	totalBytes, lastByte := t.snapshot()
 	if totalBytes == 0 {
-		return nil, fmt.Errorf("no data received")
+		return nil, t.noData()
 	}
 
-	bits := float64(totalBytes * 8)
-	mbps := (bits / 1_000_000) / duration.Seconds()
+	// The connections rarely start or finish together, so dividing all
+	// bytes by the wall clock of the slowest one understates the link, and
+	// summing each connection's own rate overstates it when they did not
+	// overlap. The aggregate is the rate over the window they all shared,
+	// or all bytes over the whole transfer when there was none.
+	aggregate, ok := window.rate()
+	if !ok {
+		aggregate = mbps(totalBytes, lastByte.Sub(start))
+	}
 
 	return &Result{
-		DownloadSpeed: mbps,
-		BytesReceived: totalBytes,
-		Duration:      duration,
-		Connections:   cfg.Downloads,
-		PeakSpeed:     mbps,
-		Errors:        errors,
+		DownloadSpeed:  aggregate,
+		BytesReceived:  totalBytes,
+		Duration:       duration,
+		Connections:    cfg.Downloads,
+		PeakSpeed:      aggregate,
+		Errors:         int(errors.Load()),
+		Requests:       cfg.Downloads,
+		ErrorRate:      float64(errors.Load()) / float64(cfg.Downloads),
+		TimeToLastByte: lastByte.Sub(start),
+		StallCount:     st.count,
+		LongestStall:   st.longest,
+		RampTime:       st.ramp,
+		Throughput:     st.rates,
+
+		DecompressedBytes: t.decodedBytes(),
+		UnknownLength:     t.unknownLength.Load(),
+		Capped:            t.capped.Load(),
+		Checksums:         t.checksums(),
+		TCP:               t.tcpStats(),
+		ConnectionSpeeds:  speeds,
 	}, nil
 }
 
+// requestSlots hands out the requests of a stress run with a request
+// count. Successes are counted apart from the requests in flight: a worker
+// only starts a request while succeeded plus in flight is below the
+// target, and waits rather than exits when it is not, since a request in
+// flight may still fail and hand its slot back. With no target every claim
+// succeeds.
+type requestSlots struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	target   int
+	maxRate  float64
+	inFlight int
+	attempts int
+	failures int
+	success  int
+	stopped  bool
+}
+
+func newRequestSlots(ctx context.Context, target int, maxRate float64) *requestSlots {
+	s := &requestSlots{target: target, maxRate: maxRate}
+	s.cond = sync.NewCond(&s.mu)
+	if target > 0 {
+		go func() {
+			<-ctx.Done()
+			s.mu.Lock()
+			s.stopped = true
+			s.mu.Unlock()
+			s.cond.Broadcast()
+		}()
+	}
+	return s
+}
+
+// claim reserves a request, waiting while the target is covered by the
+// requests in flight. It returns false once the target is met, the error
+// rate rules out meeting the limit, or the run is over.
+func (s *requestSlots) claim() bool {
+	if s.target <= 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.over() && s.success+s.inFlight >= s.target {
+		s.cond.Wait()
+	}
+	if s.over() {
+		return false
+	}
+	s.inFlight++
+	return true
+}
+
+// done gives back a claimed request, counting it as a success if ok.
+func (s *requestSlots) done(ok bool) {
+	if s.target <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.inFlight--
+	s.attempts++
+	if ok {
+		s.success++
+	} else {
+		s.failures++
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *requestSlots) over() bool {
+	if s.stopped || s.success >= s.target {
+		return true
+	}
+	return s.maxRate > 0 && s.attempts >= s.target &&
+		float64(s.failures)/float64(s.attempts) > s.maxRate
+}
+
 func runStress(ctx context.Context, cfg Config) (*Result, error) {
 	connections := cfg.Downloads
 	if connections < 10 {
@@ -119,11 +400,8 @@ func runStress(ctx context.Context, cfg Config) (*Result, error) {
 	}
 
 	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        connections,
-			MaxIdleConnsPerHost: connections,
-		},
+		Timeout:   30 * time.Second,
+		Transport: httpclient.NewTransport(connections),
 	}
 
 	stressCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
@@ -131,9 +409,14 @@ func runStress(ctx context.Context, cfg Config) (*Result, error) {
 
 	start := time.Now()
 	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var totalBytes int64
-	var errors int
+	var errors, requests atomic.Int64
+	t := &transfer{maxBytes: cfg.MaxBytes, stop: cancel, checksum: cfg.Checksum}
+
+	slots := newRequestSlots(stressCtx, cfg.Requests, cfg.MaxErrorRate)
+
+	stop := make(chan struct{})
+	stalls := make(chan watchStats, 1)
+	go t.watch(cfg.SampleInterval, cfg.StallThreshold, stop, stalls)
 
 	download := func() {
 		defer wg.Done()
@@ -143,35 +426,41 @@ func runStress(ctx context.Context, cfg Config) (*Result, error) {
 				return
 			default:
 			}
+			if !slots.claim() {
+				return
+			}
 
-			req, err := http.NewRequestWithContext(stressCtx, "GET", cfg.URL, nil)
+			reqCtx, conn := traceConn(stressCtx)
+			req, err := httpclient.NewRequest(reqCtx, "GET", cfg.URL)
 			if err != nil {
-				mu.Lock()
-				errors++
-				mu.Unlock()
+				requests.Add(1)
+				errors.Add(1)
+				slots.done(false)
 				return
 			}
+			req.Header.Set("Accept-Encoding", acceptEncoding(cfg.AllowCompression))
 
 			resp, err := client.Do(req)
-			if err != nil {
-				mu.Lock()
-				errors++
-				mu.Unlock()
-				continue
+			if err == nil && resp.StatusCode >= 400 {
+				err = t.reject(resp)
+				resp.Body.Close()
+			} else if err == nil {
+				var n int64
+				n, err = t.read(resp)
+				t.sampleTCP(*conn)
+				resp.Body.Close()
+				if err != nil && endOfStream(resp, n, err) {
+					err = nil
+				}
 			}
-
-			data, err := io.ReadAll(resp.Body)
-			resp.Body.Close()
+			if err != nil && stressCtx.Err() != nil {
+				return
+			}
+			requests.Add(1)
 			if err != nil {
-				mu.Lock()
-				errors++
-				mu.Unlock()
-				continue
+				errors.Add(1)
 			}
-
-			mu.Lock()
-			totalBytes += int64(len(data))
-			mu.Unlock()
+			slots.done(err == nil)
 		}
 	}
 
@@ -182,103 +471,42 @@ func runStress(ctx context.Context, cfg Config) (*Result, error) {
 
 	wg.Wait()
 	duration := time.Since(start)
+	close(stop)
+	st := <-stalls
 
-	mu.Lock()
-	bits := float64(totalBytes * 8)
-	avgMbps := (bits / 1_000_000) / duration.Seconds()
-	bytes := totalBytes
-	mu.Unlock()
-
+	bytes, lastByte := t.snapshot()
 	if bytes == 0 {
-		return nil, fmt.Errorf("no data received")
-	}
-
-	return &Result{
-		DownloadSpeed: avgMbps,
-		BytesReceived: bytes,
-		Duration:      duration,
-		Connections:   connections,
-		PeakSpeed:     avgMbps,
-		Errors:        errors,
-	}, nil
-}
-
-func RunP2P(ctx context.Context, targets []string, duration time.Duration) (*Result, error) {
-	if len(targets) == 0 {
-		return nil, fmt.Errorf("no targets specified")
+		return nil, t.noData()
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var totalBytes int64
-	var errors int
+	avgMbps := mbps(bytes, duration)
 
-	client := &http.Client{
-		Timeout: duration,
+	// Requests cut off by the end of the stress window are not counted as
+	// either successes or failures.
+	var errRate float64
+	if n := requests.Load(); n > 0 {
+		errRate = float64(errors.Load()) / float64(n)
 	}
 
-	worker := func(target string) {
-		defer wg.Done()
-		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
-		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
-			return
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
-			return
-		}
-		defer resp.Body.Close()
-
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			mu.Lock()
-			errors++
-			mu.Unlock()
-			return
-		}
-
-		mu.Lock()
-		totalBytes += int64(len(data))
-		mu.Unlock()
-	}
-
-	start := time.Now()
-	wg.Add(len(targets))
-	for _, target := range targets {
-		go worker(target)
-	}
-
-	done := make(chan bool)
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-	case <-ctx.Done():
-	}
-
-	elapsed := time.Since(start)
-	if elapsed == 0 {
-		elapsed = time.Nanosecond
-	}
-
-	bits := float64(totalBytes * 8)
-	mbps := (bits / 1_000_000) / elapsed.Seconds()
-
 	return &Result{
-		DownloadSpeed: mbps,
-		BytesReceived: totalBytes,
-		Duration:      elapsed,
-		Connections:   len(targets),
-		Errors:        errors,
+		DownloadSpeed:  avgMbps,
+		BytesReceived:  bytes,
+		Duration:       duration,
+		Connections:    connections,
+		PeakSpeed:      avgMbps,
+		Errors:         int(errors.Load()),
+		Requests:       int(requests.Load()),
+		ErrorRate:      errRate,
+		TimeToLastByte: lastByte.Sub(start),
+		StallCount:     st.count,
+		LongestStall:   st.longest,
+		RampTime:       st.ramp,
+		Throughput:     st.rates,
+
+		DecompressedBytes: t.decodedBytes(),
+		UnknownLength:     t.unknownLength.Load(),
+		Capped:            t.capped.Load(),
+		Checksums:         t.checksums(),
+		TCP:               t.tcpStats(),
 	}, nil
 }
@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serve runs handler on a test server that is closed when the test ends.
+func serve(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// flakyHandler serves 1000-byte bodies and cuts every failEvery-th response
+// off after 100 bytes; with failEvery 1 every response fails.
+func flakyHandler(failEvery int64) http.HandlerFunc {
+	var n atomic.Int64
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1000")
+		if n.Add(1)%failEvery != 0 {
+			w.Write([]byte(strings.Repeat("x", 1000)))
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestStressRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  int
+		failEvery int64
+	}{
+		{"no failures", 20, 1 << 62},
+		{"every third fails", 20, 3},
+		{"fewer than workers", 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, flakyHandler(tt.failEvery))
+			res, err := Run(context.Background(), Config{
+				URL:        srv.URL,
+				Downloads:  10,
+				Timeout:    10 * time.Second,
+				StressMode: true,
+				Requests:   tt.requests,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok := res.Requests - res.Errors; ok != tt.requests {
+				t.Errorf("got %d successful requests (%d attempts, %d errors), want %d",
+					ok, res.Requests, res.Errors, tt.requests)
+			}
+		})
+	}
+}
+
+func TestStressRequestsErrorRate(t *testing.T) {
+	srv := serve(t, flakyHandler(1))
+	start := time.Now()
+	res, err := Run(context.Background(), Config{
+		URL:          srv.URL,
+		Downloads:    10,
+		Timeout:      10 * time.Second,
+		StressMode:   true,
+		Requests:     20,
+		MaxErrorRate: 0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %v; want it to end on the error rate", elapsed)
+	}
+	if res.Requests-res.Errors != 0 || res.Requests < 20 {
+		t.Errorf("got %d attempts with %d errors, want at least 20 attempts, all failed", res.Requests, res.Errors)
+	}
+}
+
+func TestStandardStaggeredAggregate(t *testing.T) {
+	const (
+		conns = 3
+		chunk = 20000
+	)
+	// The i-th response starts after i*200ms and then sends chunk bytes
+	// every 10ms for a second, so each connection runs at the same rate but
+	// they overlap only in the middle.
+	var n atomic.Int64
+	body := []byte(strings.Repeat("x", chunk))
+	srv := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(n.Add(1)-1) * 200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		start := time.Now()
+		for k := 0; k < 100; k++ {
+			time.Sleep(time.Until(start.Add(time.Duration(k) * 10 * time.Millisecond)))
+			if _, err := w.Write(body); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	})
+	res, err := Run(context.Background(), Config{
+		URL:       srv.URL,
+		Downloads: conns,
+		Timeout:   10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection sends chunk bytes per 10ms; while all three run the
+	// link carries three times that. Summing each connection's rate over its
+	// own lifetime, waiting included, comes out about 15% low.
+	want := conns * float64(chunk) * 8 / 1e6 / 0.01
+	if res.DownloadSpeed < want*0.9 || res.DownloadSpeed > want*1.1 {
+		t.Errorf("aggregate %.1f Mbps, want %.1f within 10%% (per connection %v)",
+			res.DownloadSpeed, want, res.ConnectionSpeeds)
+	}
+}
+
+// chunkedHandler sends chunks pieces of 10000 bytes, flushing after each so
+// the response goes out chunked without a Content-Length; with chunks 0 it
+// streams until the client goes away. With length set it sends the same
+// body with a Content-Length instead.
+func chunkedHandler(chunks int, length bool) http.HandlerFunc {
+	body := []byte(strings.Repeat("x", 10000))
+	return func(w http.ResponseWriter, r *http.Request) {
+		if length {
+			w.Header().Set("Content-Length", strconv.Itoa(chunks*len(body)))
+		}
+		for i := 0; chunks == 0 || i < chunks; i++ {
+			if _, err := w.Write(body); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestUnknownLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  int
+		length  bool
+		stress  bool
+		unknown bool
+	}{
+		{"content length", 20, true, false, false},
+		{"chunked to the end", 20, false, false, true},
+		{"chunked until the timeout", 0, false, false, true},
+		{"stress, chunked until the timeout", 0, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, chunkedHandler(tt.chunks, tt.length))
+			res, err := Run(context.Background(), Config{
+				URL:        srv.URL,
+				Downloads:  2,
+				Timeout:    300 * time.Millisecond,
+				StressMode: tt.stress,
+				Requests:   2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.UnknownLength != tt.unknown {
+				t.Errorf("UnknownLength = %v, want %v", res.UnknownLength, tt.unknown)
+			}
+			if res.Errors != 0 {
+				t.Errorf("got %d errors, want none", res.Errors)
+			}
+			if tt.chunks > 0 && res.BytesReceived != int64(2*tt.chunks*10000) {
+				t.Errorf("received %d bytes, want %d", res.BytesReceived, 2*tt.chunks*10000)
+			}
+			if res.BytesReceived == 0 || res.DownloadSpeed <= 0 {
+				t.Errorf("received %d bytes at %.1f Mbps, want a measurement",
+					res.BytesReceived, res.DownloadSpeed)
+			}
+		})
+	}
+}
+
+// TestLoopbackMicroseconds downloads a body small enough to arrive in
+// microseconds, where the rate must stay bounded by minRateWindow.
+func TestLoopbackMicroseconds(t *testing.T) {
+	srv := serve(t, chunkedHandler(1, true))
+	res, err := Run(context.Background(), Config{
+		URL:       srv.URL,
+		Downloads: 2,
+		Timeout:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := mbps(res.BytesReceived, minRateWindow)
+	if res.DownloadSpeed <= 0 || res.DownloadSpeed > limit {
+		t.Errorf("download speed %v Mbps, want above 0 and at most %v", res.DownloadSpeed, limit)
+	}
+	for _, s := range res.ConnectionSpeeds {
+		if s > limit {
+			t.Errorf("connection speed %v Mbps above %v", s, limit)
+		}
+	}
+}
+
+// rejectHandler answers every rejectEvery-th request with a 503 error page
+// and the others with a 1000-byte body.
+func rejectHandler(rejectEvery int64) http.HandlerFunc {
+	var n atomic.Int64
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1)%rejectEvery == 0 {
+			http.Error(w, strings.Repeat("busy ", 200), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		rejectEvery int64
+		stress      bool
+		errorRate   float64
+		err         string
+	}{
+		{"every other request", 2, false, 0.5, ""},
+		{"stress, every other request", 2, true, 0.5, ""},
+		{"every request", 1, false, 0, "HTTP 503"},
+		{"stress, every request", 1, true, 0, "HTTP 503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serve(t, rejectHandler(tt.rejectEvery))
+			res, err := Run(context.Background(), Config{
+				URL:          srv.URL,
+				Downloads:    4,
+				Timeout:      5 * time.Second,
+				StressMode:   tt.stress,
+				Requests:     10,
+				MaxErrorRate: 0.9,
+				Checksum:     true,
+			})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one naming %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.ErrorRate < tt.errorRate-0.1 || res.ErrorRate > tt.errorRate+0.1 {
+				t.Errorf("error rate %.2f (%d of %d), want about %.2f",
+					res.ErrorRate, res.Errors, res.Requests, tt.errorRate)
+			}
+			ok := int64(res.Requests - res.Errors)
+			if res.BytesReceived != ok*1000 || len(res.Checksums) != int(ok) {
+				t.Errorf("%d bytes and %d checksums from %d successful requests; want the error pages left out",
+					res.BytesReceived, len(res.Checksums), ok)
+			}
+		})
+	}
+}
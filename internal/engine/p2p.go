@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// P2P node states. A node is slow when it delivers less than half the
+// median speed of the nodes that answered.
+const (
+	NodeReachable = "reachable"
+	NodeSlow      = "slow"
+	NodeDead      = "dead"
+)
+
+// NodeResult is what one P2P target delivered. Speed covers the node's
+// own transfer time, from the request of the attempt that succeeded to its
+// last byte.
+type NodeResult struct {
+	URL      string
+	Status   string
+	Bytes    int64
+	Speed    float64
+	Latency  time.Duration
+	Duration time.Duration
+	Attempts int
+	Error    string
+
+	// finished is when the node's last byte arrived, relative to the
+	// start of the run.
+	finished time.Duration
+}
+
+// p2pSampleInterval is the length of the intervals the swarm's combined
+// byte count is split into for its peak rate.
+const p2pSampleInterval = 100 * time.Millisecond
+
+// swarmRate adds up the bytes per p2pSampleInterval of the attempts that
+// succeeded. An attempt that fails is left out, so the bytes it moved
+// before a retry do not count twice towards the peak.
+type swarmRate struct {
+	mu    sync.Mutex
+	slots []int64
+}
+
+func (s *swarmRate) add(slots []int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(slots) > len(s.slots) {
+		s.slots = append(s.slots, make([]int64, len(slots)-len(s.slots))...)
+	}
+	for i, n := range slots {
+		s.slots[i] += n
+	}
+}
+
+// peak is the highest rate of one interval.
+func (s *swarmRate) peak() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var peak float64
+	for _, n := range s.slots {
+		peak = max(peak, mbps(n, p2pSampleInterval))
+	}
+	return peak
+}
+
+// DefaultP2PWorkers caps the number of simultaneous P2P downloads when no
+// concurrency is given, so a long target list is drained in batches.
+const DefaultP2PWorkers = 32
+
+// RunP2P downloads from the targets with a pool of concurrency workers
+// draining a queue. Below the target count, targets wait their turn; above
+// it, every target is queued concurrency/len(targets) times so each one
+// gets that many parallel streams, merged into one node result. 0 means
+// one worker per target, up to DefaultP2PWorkers.
+//
+// A transient failure (a network error or a 5xx/429 response) is retried
+// once; a node whose streams all fail is dead. The average speed is the
+// bytes of the live nodes over the time until the last of them finished,
+// so a dead node that hangs until the timeout does not dilute it. Nodes
+// rarely overlap for the whole run, so the average understates what the
+// swarm can deliver at once: PeakSpeed is the highest rate of all streams
+// together over one sample interval, the sum of their instantaneous rates.
+// Only attempts that succeeded count towards it.
+func RunP2P(ctx context.Context, targets []string, duration time.Duration, concurrency int) (*Result, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets specified")
+	}
+	if concurrency <= 0 {
+		concurrency = min(len(targets), DefaultP2PWorkers)
+	}
+	streams := 1
+	if concurrency > len(targets) {
+		streams = concurrency / len(targets)
+		concurrency = streams * len(targets)
+	}
+
+	client := httpclient.New(duration)
+	results := make([][]NodeResult, len(targets))
+	jobs := make(chan [2]int, len(targets)*streams)
+	for i := range targets {
+		results[i] = make([]NodeResult, streams)
+		for s := 0; s < streams; s++ {
+			jobs <- [2]int{i, s}
+		}
+	}
+	close(jobs)
+
+	start := time.Now()
+	swarm := &swarmRate{}
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results[job[0]][job[1]] = fetchNode(ctx, client, targets[job[0]], start, swarm)
+			}
+		}()
+	}
+	wg.Wait()
+
+	nodes := make([]NodeResult, len(targets))
+	for i := range targets {
+		nodes[i] = mergeStreams(results[i])
+	}
+	classifyNodes(nodes)
+
+	var bytes int64
+	var window time.Duration
+	var dead int
+	for _, n := range nodes {
+		if n.Status == NodeDead {
+			dead++
+			continue
+		}
+		bytes += n.Bytes
+		if n.finished > window {
+			window = n.finished
+		}
+	}
+	if window <= 0 {
+		window = time.Since(start)
+	}
+
+	// A run shorter than one sample interval has no interval rates.
+	average := mbps(bytes, window)
+	return &Result{
+		DownloadSpeed: average,
+		PeakSpeed:     max(swarm.peak(), average),
+		BytesReceived: bytes,
+		Duration:      window,
+		Connections:   concurrency,
+		Errors:        dead,
+		Requests:      len(targets),
+		ErrorRate:     float64(dead) / float64(len(targets)),
+		Nodes:         nodes,
+	}, nil
+}
+
+// mergeStreams combines the parallel streams to one target. Their speeds
+// add up; the node is dead only if every stream failed.
+func mergeStreams(streams []NodeResult) NodeResult {
+	n := NodeResult{URL: streams[0].URL, Status: NodeDead}
+	for _, s := range streams {
+		n.Attempts += s.Attempts
+		if s.Status == NodeDead {
+			n.Error = s.Error
+			continue
+		}
+		n.Status = ""
+		n.Bytes += s.Bytes
+		n.Speed += s.Speed
+		n.Duration = max(n.Duration, s.Duration)
+		n.finished = max(n.finished, s.finished)
+		if n.Latency == 0 || s.Latency < n.Latency {
+			n.Latency = s.Latency
+		}
+	}
+	if n.Status != NodeDead {
+		n.Error = ""
+	}
+	return n
+}
+
+// fetchNode downloads target, retrying once after a transient failure.
+// The bytes of the attempt that succeeded also count towards swarm.
+func fetchNode(ctx context.Context, client *http.Client, target string, runStart time.Time, swarm *swarmRate) NodeResult {
+	n := NodeResult{URL: target}
+	for n.Attempts < 2 {
+		n.Attempts++
+		t := &transfer{slotStart: runStart}
+		attemptStart := time.Now()
+		retry, err := fetchOnce(ctx, client, target, t, &n)
+		bytes, _ := t.snapshot()
+		n.Bytes = bytes
+		n.Duration = time.Since(attemptStart)
+		n.finished = time.Since(runStart)
+		if err == nil {
+			n.Error = ""
+			n.Speed = mbps(bytes, n.Duration)
+			swarm.add(t.slots)
+			return n
+		}
+		n.Error = err.Error()
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	n.Status = NodeDead
+	return n
+}
+
+// fetchOnce makes one attempt and reports whether a failure is worth
+// retrying.
+func fetchOnce(ctx context.Context, client *http.Client, target string, t *transfer, n *NodeResult) (bool, error) {
+	req, err := httpclient.NewRequest(ctx, "GET", target)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding(false))
+
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	n.Latency = time.Since(sent)
+
+	if resp.StatusCode >= 400 {
+		transient := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return transient, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if _, err := t.read(resp); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// classifyNodes marks each node that answered as reachable or slow.
+func classifyNodes(nodes []NodeResult) {
+	var speeds []float64
+	for _, n := range nodes {
+		if n.Status != NodeDead {
+			speeds = append(speeds, n.Speed)
+		}
+	}
+	if len(speeds) == 0 {
+		return
+	}
+	sort.Float64s(speeds)
+	median := speeds[len(speeds)/2]
+	if len(speeds)%2 == 0 {
+		median = (speeds[len(speeds)/2-1] + median) / 2
+	}
+
+	for i := range nodes {
+		if nodes[i].Status == NodeDead {
+			continue
+		}
+		nodes[i].Status = NodeReachable
+		if nodes[i].Speed < median/2 {
+			nodes[i].Status = NodeSlow
+		}
+	}
+}
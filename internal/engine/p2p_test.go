@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestP2PRetryPeak(t *testing.T) {
+	// The first response is cut off after 5MB of a promised 10MB; the
+	// retry gets 100KB slowly, 10KB every 20ms, and succeeds.
+	var n atomic.Int64
+	srv := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(10<<20))
+			w.Write(make([]byte, 5<<20))
+			w.(http.Flusher).Flush()
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+		chunk := []byte(strings.Repeat("x", 10_000))
+		w.Header().Set("Content-Length", strconv.Itoa(10*len(chunk)))
+		for i := 0; i < 10; i++ {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	res, err := RunP2P(context.Background(), []string{srv.URL}, 10*time.Second, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := res.Nodes[0]
+	if node.Status == NodeDead || node.Attempts != 2 {
+		t.Fatalf("node %s after %d attempts (%s), want it alive after a retry",
+			node.Status, node.Attempts, node.Error)
+	}
+	if res.BytesReceived != 100_000 {
+		t.Errorf("received %d bytes, want the 100000 of the retry", res.BytesReceived)
+	}
+	// The retry moves at most 60KB in an interval, under 5 Mbps; the 5MB
+	// of the failed attempt would make the peak hundreds.
+	if res.PeakSpeed > 10 {
+		t.Errorf("peak %.1f Mbps, want the failed attempt left out", res.PeakSpeed)
+	}
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+const loadedProbeInterval = 250 * time.Millisecond
+
+// probeLoaded sends a HEAD request every loadedProbeInterval over the
+// shared client, which never shares a connection with the download's own
+// transport, until stop is closed. It sends the completed probes on out.
+func probeLoaded(ctx context.Context, url string, stop <-chan struct{}, out chan<- []LatencySample) {
+	client := httpclient.New(5 * time.Second)
+	ticker := time.NewTicker(loadedProbeInterval)
+	defer ticker.Stop()
+
+	var samples []LatencySample
+	for {
+		select {
+		case <-stop:
+			out <- samples
+			return
+		case <-ctx.Done():
+			out <- samples
+			return
+		case <-ticker.C:
+		}
+
+		reqCtx, err := httpclient.Admit(ctx)
+		if err != nil {
+			continue
+		}
+		req, err := httpclient.NewRequest(reqCtx, "HEAD", url)
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		rtt := time.Since(start)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		samples = append(samples, LatencySample{Time: start, RTT: rtt})
+	}
+}
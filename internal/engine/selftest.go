@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+)
+
+// SelfTest runs the download engine against an in-process loopback server
+// serving size random bytes. Since no real network is involved, the result
+// is the throughput ceiling of PulseGo itself on this machine.
+func SelfTest(ctx context.Context, size int64, downloads int, timeout time.Duration) (*Result, error) {
+	payload := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	return Run(ctx, Config{
+		URL:       srv.URL,
+		Downloads: downloads,
+		Timeout:   timeout,
+	})
+}
@@ -0,0 +1,323 @@
+package engine
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// transfer accumulates the bytes of all connections in a run. bytes counts
+// what crossed the wire, decoded what the body expanded to after any
+// content-encoding was removed.
+type transfer struct {
+	bytes    atomic.Int64
+	decoded  atomic.Int64
+	lastByte atomic.Int64
+
+	// unknownLength is set when a response came without Content-Length,
+	// as with chunked transfer encoding.
+	unknownLength atomic.Bool
+
+	// With maxBytes set, stop is called once that many bytes have been
+	// received and capped is set.
+	maxBytes int64
+	stop     func()
+	capped   atomic.Bool
+
+	// With checksum set, the decoded body of every response is hashed and
+	// the hashes of complete bodies are collected in sums.
+	checksum bool
+	mu       sync.Mutex
+	sums     []string
+
+	// rejected is the status of the last error response, which reject
+	// left out of the totals.
+	rejected string
+
+	// tcp holds the latest kernel statistics of each connection.
+	tcp map[net.Conn]httpclient.TCPInfo
+
+	// With slotStart set, the bytes are also counted in slots, one per
+	// p2pSampleInterval since slotStart, so a P2P run can add up the rates
+	// of the attempts that succeeded once they are over. A transfer with
+	// slots is read by one goroutine only.
+	slotStart time.Time
+	slots     []int64
+}
+
+type wireCounter struct {
+	r io.Reader
+	t *transfer
+	n int64
+}
+
+func (c *wireCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		total := c.t.bytes.Add(int64(n))
+		now := time.Now()
+		c.t.lastByte.Store(now.UnixNano())
+		if !c.t.slotStart.IsZero() {
+			i := int(now.Sub(c.t.slotStart) / p2pSampleInterval)
+			if i >= len(c.t.slots) {
+				c.t.slots = append(c.t.slots, make([]int64, i+1-len(c.t.slots))...)
+			}
+			c.t.slots[i] += int64(n)
+		}
+		if c.t.maxBytes > 0 && total >= c.t.maxBytes && !c.t.capped.Swap(true) {
+			c.t.stop()
+		}
+	}
+	return n, err
+}
+
+// watchStats is what watch learned from the byte counter: stalls, the
+// peak interval rate, and how long the transfer took to first reach 90% of
+// it.
+type watchStats struct {
+	count   int
+	longest time.Duration
+	peak    float64
+	ramp    time.Duration
+
+	// rates is the throughput of each interval.
+	rates []RateSample
+}
+
+// read drains resp into the run totals and returns the wire bytes this
+// response contributed.
+func (t *transfer) read(resp *http.Response) (int64, error) {
+	if resp.ContentLength < 0 {
+		t.unknownLength.Store(true)
+	}
+	wire := &wireCounter{r: resp.Body, t: t}
+	var body io.Reader = wire
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return wire.n, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	var h hash.Hash
+	if t.checksum {
+		h = sha256.New()
+		body = io.TeeReader(body, h)
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			t.decoded.Add(int64(n))
+		}
+		if err == io.EOF {
+			if h != nil {
+				t.mu.Lock()
+				t.sums = append(t.sums, hex.EncodeToString(h.Sum(nil)))
+				t.mu.Unlock()
+			}
+			return wire.n, nil
+		}
+		if err != nil {
+			return wire.n, err
+		}
+	}
+}
+
+// reject drains an error response without counting it, so the connection
+// can be reused, and remembers its status. An error page is not the test
+// file, and measuring it would pass a refused request off as a download.
+func (t *transfer) reject(resp *http.Response) error {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	t.mu.Lock()
+	t.rejected = resp.Status
+	t.mu.Unlock()
+	return fmt.Errorf("HTTP %s", resp.Status)
+}
+
+// noData is the error of a run that received nothing, naming the status
+// the server answered with when it rejected the requests.
+func (t *transfer) noData() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rejected != "" {
+		return fmt.Errorf("no data received: HTTP %s", t.rejected)
+	}
+	return fmt.Errorf("no data received")
+}
+
+func (t *transfer) snapshot() (int64, time.Time) {
+	return t.bytes.Load(), time.Unix(0, t.lastByte.Load())
+}
+
+func (t *transfer) decodedBytes() int64 {
+	return t.decoded.Load()
+}
+
+// traceConn returns ctx with a trace that records the connection a request
+// is sent on, for sampleTCP.
+func traceConn(ctx context.Context) (context.Context, *net.Conn) {
+	conn := new(net.Conn)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { *conn = info.Conn },
+	}), conn
+}
+
+// sampleTCP reads the kernel statistics of conn once a response on it has
+// been read. The counters are cumulative, so only the latest sample of a
+// connection is kept.
+func (t *transfer) sampleTCP(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	info, err := httpclient.ReadTCPInfo(conn)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tcp == nil {
+		t.tcp = make(map[net.Conn]httpclient.TCPInfo)
+	}
+	t.tcp[conn] = info
+}
+
+func (t *transfer) tcpStats() *TCPStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.tcp) == 0 {
+		return nil
+	}
+	st := &TCPStats{Connections: len(t.tcp)}
+	for _, info := range t.tcp {
+		st.Retransmits += int(info.Retransmits)
+		st.RTT += info.RTT
+		st.RTTVar += info.RTTVar
+	}
+	st.RTT /= time.Duration(st.Connections)
+	st.RTTVar /= time.Duration(st.Connections)
+	return st
+}
+
+func (t *transfer) checksums() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.sums...)
+}
+
+// endOfStream reports whether err only means that a response of unknown
+// length was still streaming when the download timeout hit. Such a
+// download is measured by duration rather than size, so it is not an error.
+func endOfStream(resp *http.Response, n int64, err error) bool {
+	if resp.ContentLength >= 0 || n == 0 {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// minRateWindow is the shortest time a rate is computed over. A transfer
+// that finishes faster, as on loopback, mostly measures buffer copies, and
+// dividing by a few microseconds or by zero gives absurd or infinite Mbps.
+const minRateWindow = time.Millisecond
+
+// mbps is the rate of bytes over d, with d raised to minRateWindow.
+func mbps(bytes int64, d time.Duration) float64 {
+	d = max(d, minRateWindow)
+	return float64(bytes*8) / 1_000_000 / d.Seconds()
+}
+
+func acceptEncoding(allowCompression bool) string {
+	if allowCompression {
+		return "gzip"
+	}
+	return "identity"
+}
+
+// watch samples the byte counter every interval and counts runs of
+// intervals without progress that last at least threshold. Idle time
+// before the first byte is connection setup, not a stall. The per-interval
+// rates are kept to find the ramp time once the run is over.
+func (t *transfer) watch(interval, threshold time.Duration, stop <-chan struct{}, out chan<- watchStats) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var st watchStats
+	var last int64
+	var idle time.Duration
+	var rates []float64
+	var at []time.Duration
+
+	flush := func() {
+		if idle >= threshold {
+			st.count++
+			if idle > st.longest {
+				st.longest = idle
+			}
+		}
+		idle = 0
+	}
+
+	for {
+		select {
+		case <-stop:
+			flush()
+			st.peak, st.ramp = rampTime(rates, at)
+			out <- st
+			return
+		case <-ticker.C:
+			bytes, _ := t.snapshot()
+			rate := float64((bytes-last)*8) / 1_000_000 / interval.Seconds()
+			rates = append(rates, rate)
+			at = append(at, time.Since(start))
+			st.rates = append(st.rates, RateSample{Time: time.Now(), Mbps: rate})
+			if bytes == 0 {
+				continue
+			}
+			if bytes == last {
+				idle += interval
+			} else {
+				flush()
+			}
+			last = bytes
+		}
+	}
+}
+
+// rampTime returns the peak of the interval rates and the elapsed time at
+// which a rate first reached 90% of it.
+func rampTime(rates []float64, at []time.Duration) (float64, time.Duration) {
+	var peak float64
+	for _, r := range rates {
+		if r > peak {
+			peak = r
+		}
+	}
+	if peak == 0 {
+		return 0, 0
+	}
+	for i, r := range rates {
+		if r >= 0.9*peak {
+			return peak, at[i]
+		}
+	}
+	return peak, 0
+}
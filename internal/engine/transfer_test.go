@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readAll drains size bytes through a wireCounter on t in reads of at most
+// chunk bytes and returns what the counter saw.
+func readAll(t *transfer, size, chunk int) int64 {
+	c := &wireCounter{r: bytes.NewReader(make([]byte, size)), t: t}
+	buf := make([]byte, chunk)
+	for {
+		if _, err := c.Read(buf); err != nil {
+			return c.n
+		}
+	}
+}
+
+func TestWireCounterConcurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		readers int
+		size    int
+		chunk   int
+	}{
+		{"one reader", 1, 1 << 20, 32 * 1024},
+		{"eight readers", 8, 1 << 20, 32 * 1024},
+		{"64 readers, small reads", 64, 256 * 1024, 1500},
+		{"64 readers, odd sizes", 64, 100_003, 4097},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &transfer{}
+			var wg sync.WaitGroup
+			var short atomic.Int64
+			for i := 0; i < tt.readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if n := readAll(tr, tt.size, tt.chunk); n != int64(tt.size) {
+						short.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			want := int64(tt.readers * tt.size)
+			if short.Load() != 0 {
+				t.Errorf("%d readers counted the wrong number of bytes", short.Load())
+			}
+			if got, last := tr.snapshot(); got != want || last.IsZero() {
+				t.Errorf("transfer counted %d bytes, last at %v; want %d", got, last, want)
+			}
+		})
+	}
+}
+
+func TestWireCounterSlots(t *testing.T) {
+	tr := &transfer{slotStart: time.Now().Add(-3 * p2pSampleInterval / 2)}
+	if n := readAll(tr, 100_000, 4096); n != 100_000 {
+		t.Fatalf("counted %d bytes, want 100000", n)
+	}
+	if len(tr.slots) != 2 || tr.slots[0] != 0 || tr.slots[1] != 100_000 {
+		t.Errorf("slots %v, want all bytes in the second", tr.slots)
+	}
+}
+
+func TestWireCounterCap(t *testing.T) {
+	var stops atomic.Int64
+	tr := &transfer{maxBytes: 1 << 20, stop: func() { stops.Add(1) }}
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readAll(tr, 64*1024, 1500)
+		}()
+	}
+	wg.Wait()
+	if !tr.capped.Load() || stops.Load() != 1 {
+		t.Errorf("capped %v with %d stop calls; want capped with one", tr.capped.Load(), stops.Load())
+	}
+}
+
+// BenchmarkWireCounter reads through one transfer from at least 64
+// goroutines at once, as a stress run with many connections does.
+func BenchmarkWireCounter(b *testing.B) {
+	tr := &transfer{}
+	src := make([]byte, 32*1024)
+	b.SetParallelism(64)
+	b.SetBytes(int64(len(src)))
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, len(src))
+		r := bytes.NewReader(src)
+		c := &wireCounter{r: r, t: tr}
+		for pb.Next() {
+			r.Reset(src)
+			if _, err := c.Read(buf); err != nil && err != io.EOF {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestMbps(t *testing.T) {
+	tests := []struct {
+		name  string
+		bytes int64
+		d     time.Duration
+		want  float64
+	}{
+		{"one second", 1_000_000, time.Second, 8},
+		{"at the window", 1_000, time.Millisecond, 8},
+		{"zero duration", 1_000, 0, 8},
+		{"microseconds", 1_000, 3 * time.Microsecond, 8},
+		{"negative duration", 1_000, -time.Second, 8},
+		{"no bytes", 0, time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mbps(tt.bytes, tt.d)
+			if math.IsInf(got, 0) || math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("mbps(%d, %v) = %v, want %v", tt.bytes, tt.d, got, tt.want)
+			}
+		})
+	}
+}
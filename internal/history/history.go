@@ -0,0 +1,132 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Entry is one run as recorded in a history file, one JSON object per
+// line. A metric that was not measured is 0.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Target       string    `json:"target"`
+	DownloadMbps float64   `json:"download_mbps,omitempty"`
+	LatencyMs    float64   `json:"latency_ms,omitempty"`
+	JitterMs     float64   `json:"jitter_ms,omitempty"`
+}
+
+// Trend places a run among the earlier runs to the same target. Runs
+// counts them all, this one included; the averages cover the runs within
+// Window before it, and are 0 for a metric none of them measured. The
+// deltas are the run's deviation from each average as a fraction of it,
+// e.g. -0.12 for 12% below, and 0 when there is nothing to compare.
+type Trend struct {
+	Runs       int
+	Window     time.Duration
+	WindowRuns int
+
+	DownloadAvg float64
+	LatencyAvg  float64
+	JitterAvg   float64
+
+	DownloadDelta float64
+	LatencyDelta  float64
+	JitterDelta   float64
+}
+
+// Load reads the entries for target from path. A missing file is an empty
+// history, not an error.
+func Load(path, target string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		// A line cut short by a crash mid-write is skipped rather than
+		// making the whole history unreadable.
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.Target != target {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Append adds e to the history file at path, creating it if needed.
+func Append(path string, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Compute returns the trend of cur against past, the earlier entries for
+// the same target, averaging those within window before cur.
+func Compute(past []Entry, cur Entry, window time.Duration) *Trend {
+	t := &Trend{Runs: len(past) + 1, Window: window}
+	var down, lat, jit avg
+	for _, e := range past {
+		if e.Time.After(cur.Time) || cur.Time.Sub(e.Time) > window {
+			continue
+		}
+		t.WindowRuns++
+		down.add(e.DownloadMbps)
+		lat.add(e.LatencyMs)
+		jit.add(e.JitterMs)
+	}
+	t.DownloadAvg, t.LatencyAvg, t.JitterAvg = down.mean(), lat.mean(), jit.mean()
+	t.DownloadDelta = deviation(cur.DownloadMbps, t.DownloadAvg)
+	t.LatencyDelta = deviation(cur.LatencyMs, t.LatencyAvg)
+	t.JitterDelta = deviation(cur.JitterMs, t.JitterAvg)
+	return t
+}
+
+// deviation is how far v lies from avg as a fraction of avg, or 0 when
+// either is unknown.
+func deviation(v, avg float64) float64 {
+	if v <= 0 || avg <= 0 {
+		return 0
+	}
+	return (v - avg) / avg
+}
+
+// avg averages the values that were measured, skipping zeros.
+type avg struct {
+	sum float64
+	n   int
+}
+
+func (a *avg) add(v float64) {
+	if v > 0 {
+		a.sum += v
+		a.n++
+	}
+}
+
+func (a avg) mean() float64 {
+	if a.n == 0 {
+		return 0
+	}
+	return a.sum / float64(a.n)
+}
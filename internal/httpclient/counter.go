@@ -0,0 +1,27 @@
+package httpclient
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+var received atomic.Int64
+
+// countingConn adds everything read from a connection to the process-wide
+// received total.
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	received.Add(int64(n))
+	return n, err
+}
+
+// BytesReceived returns the bytes read so far from every TCP connection
+// opened through this package, including headers and TLS overhead. HTTP/3
+// traffic is not counted.
+func BytesReceived() int64 {
+	return received.Load()
+}
@@ -0,0 +1,43 @@
+package httpclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dscpNames maps the standard per-hop behaviour names to their code points.
+var dscpNames = map[string]int{
+	"BE": 0, "LE": 1,
+	"CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+	"VA": 44, "EF": 46,
+}
+
+// ParseDSCP accepts a per-hop behaviour name such as EF, CS6 or AF41, or a
+// code point from 0 to 63.
+func ParseDSCP(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if v, ok := dscpNames[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(s, 0, 0)
+	if err != nil || v < 0 || v > 63 {
+		return 0, fmt.Errorf("invalid DSCP %q: use a name such as EF, CS6 or AF41, or a number from 0 to 63", s)
+	}
+	return int(v), nil
+}
+
+// DSCPString formats a code point with its name when it has one, e.g.
+// "EF (46)".
+func DSCPString(v int) string {
+	for name, code := range dscpNames {
+		if code == v {
+			return fmt.Sprintf("%s (%d)", name, v)
+		}
+	}
+	return strconv.Itoa(v)
+}
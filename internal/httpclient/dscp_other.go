@@ -0,0 +1,14 @@
+//go:build !unix
+
+package httpclient
+
+import (
+	"errors"
+	"syscall"
+)
+
+const dscpSupported = false
+
+func markConn(string, syscall.RawConn, int) error {
+	return errors.New("DSCP marking is not supported on this platform")
+}
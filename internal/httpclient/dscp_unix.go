@@ -0,0 +1,27 @@
+//go:build unix
+
+package httpclient
+
+import (
+	"strings"
+	"syscall"
+)
+
+const dscpSupported = true
+
+// markConn sets the DSCP code point in the IP header of a socket. The ToS
+// byte and the IPv6 traffic class carry DSCP in their upper six bits.
+func markConn(network string, c syscall.RawConn, dscp int) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		if strings.HasSuffix(network, "6") {
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2)
+		} else {
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
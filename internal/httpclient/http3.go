@@ -0,0 +1,15 @@
+//go:build http3
+
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+const HTTP3Available = true
+
+func newHTTP3Transport() http.RoundTripper {
+	return &http3.Transport{}
+}
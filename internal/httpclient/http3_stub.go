@@ -0,0 +1,23 @@
+//go:build !http3
+
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTP3Available reports whether this binary was built with the http3 tag.
+// The default build leaves QUIC out to keep the binary and its
+// dependencies small.
+const HTTP3Available = false
+
+type noHTTP3 struct{}
+
+func (noHTTP3) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("HTTP/3 support is not compiled in")
+}
+
+func newHTTP3Transport() http.RoundTripper {
+	return noHTTP3{}
+}
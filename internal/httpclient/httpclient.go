@@ -0,0 +1,212 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Options are transport settings applied to every client PulseGo creates,
+// so each measurement phase talks to the network the same way.
+type Options struct {
+	DisableKeepAlives bool
+	UserAgent         string
+
+	// HTTP3 sends every request over QUIC. It needs a build with the
+	// http3 tag; Configure reports an error otherwise.
+	HTTP3 bool
+
+	// Family restricts connections to "tcp4" or "tcp6"; empty allows both.
+	Family string
+
+	// DSCP marks every connection with this code point (1-63) so QoS
+	// policies can be tested; 0 leaves the system default.
+	DSCP int
+
+	// SmallProbes asks for a single byte in latency probes, so they do
+	// not pull in the start of a large test file; see NewProbeRequest.
+	SmallProbes bool
+
+	// Pool tuning for TCP transports; zero values keep the defaults.
+	// MaxConnsPerHost caps the connections, active or idle, to one host
+	// (default unlimited), so extra streams queue for a free connection.
+	// MaxIdleConnsPerHost is how many connections stay open between
+	// requests (default: the number of streams of a NewTransport, or 2
+	// for the shared transport). IdleConnTimeout closes connections idle
+	// for that long (default 90s).
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// RateLimit caps requests per second across all transports; 0 is
+	// unlimited. Backoff429 pauses all requests after a 429 response for
+	// its Retry-After, or a second without one.
+	RateLimit  float64
+	Backoff429 bool
+
+	// FallbackResolvers are DNS servers (ip:port) tried in order when the
+	// system resolver fails for a host; see FallbackAnswers.
+	FallbackResolvers []string
+
+	// Resolve pins hosts to IPs: connections to a host in it go to its IP
+	// without a DNS lookup, while TLS and the Host header keep the name.
+	Resolve map[string]string
+}
+
+// Version is reported in the default User-Agent. Release builds set it
+// with -ldflags "-X github.com/LoboGuardian/pulsego/internal/httpclient.Version=...".
+var Version = "dev"
+
+// BrowserUserAgent is a current desktop Chrome UA for servers that block
+// or reshape traffic from unknown clients.
+const BrowserUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+func DefaultUserAgent() string {
+	return "PulseGo/" + Version
+}
+
+var (
+	mu      sync.RWMutex
+	current Options
+	shared  http.RoundTripper = newTransport(Options{}, 0)
+)
+
+func Configure(opts Options) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if opts.HTTP3 && !HTTP3Available {
+		return fmt.Errorf("HTTP/3 support is not compiled in; rebuild with -tags http3")
+	}
+	if opts.DSCP != 0 && opts.HTTP3 {
+		return fmt.Errorf("DSCP marking is not supported over HTTP/3")
+	}
+	if opts.DSCP != 0 && !dscpSupported {
+		return fmt.Errorf("DSCP marking is not supported on this platform")
+	}
+	if len(opts.Resolve) > 0 && opts.HTTP3 {
+		return fmt.Errorf("pinning hosts to IPs is not supported over HTTP/3")
+	}
+	closeIdle(shared)
+	current = opts
+	shared = newTransport(opts, 0)
+	configureLimiter(opts)
+	return nil
+}
+
+func Current() Options {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// NewRequest builds an outgoing request with the configured User-Agent.
+// Every measurement phase creates its requests here.
+func NewRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	ua := Current().UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent()
+	}
+	req.Header.Set("User-Agent", ua)
+	return req, nil
+}
+
+// NewProbeRequest builds a GET request for a latency probe. With
+// SmallProbes set it asks for the first byte only; servers that ignore
+// Range still answer with the whole file.
+func NewProbeRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := NewRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, err
+	}
+	if Current().SmallProbes {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	return req, nil
+}
+
+// NewTransport returns a dedicated transport that keeps up to conns idle
+// connections, for callers that run their own parallel streams such as the
+// download engine. Over HTTP/3 the streams share one QUIC connection.
+func NewTransport(conns int) http.RoundTripper {
+	return newTransport(Current(), conns)
+}
+
+// New returns a client backed by the shared transport.
+func New(timeout time.Duration) *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: shared,
+	}
+}
+
+func newTransport(opts Options, conns int) http.RoundTripper {
+	return limitedTransport{newBaseTransport(opts, conns)}
+}
+
+func newBaseTransport(opts Options, conns int) http.RoundTripper {
+	if opts.HTTP3 {
+		return newHTTP3Transport()
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableKeepAlives = opts.DisableKeepAlives
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if opts.DSCP != 0 {
+		dialer.Control = func(network, _ string, c syscall.RawConn) error {
+			return markConn(network, c, opts.DSCP)
+		}
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opts.Family != "" {
+			network = opts.Family
+		}
+		var conn net.Conn
+		var err error
+		if pinned, ok := pinnedAddr(opts.Resolve, addr); ok {
+			conn, err = dialer.DialContext(ctx, network, pinned)
+		} else if len(opts.FallbackResolvers) > 0 && fellBack(addr) {
+			// The system resolver already failed for this host; do not
+			// wait for it again on every new connection.
+			conn, err = dialFallback(ctx, dialer.DialContext, opts.FallbackResolvers, network, addr, nil)
+		} else {
+			conn, err = dialer.DialContext(ctx, network, addr)
+			var dnsErr *net.DNSError
+			if err != nil && len(opts.FallbackResolvers) > 0 && errors.As(err, &dnsErr) {
+				conn, err = dialFallback(ctx, dialer.DialContext, opts.FallbackResolvers, network, addr, err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{conn}, nil
+	}
+	if conns > 0 {
+		t.MaxIdleConns = conns
+		t.MaxIdleConnsPerHost = conns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		t.MaxIdleConns = max(t.MaxIdleConns, opts.MaxIdleConnsPerHost)
+	}
+	t.MaxConnsPerHost = opts.MaxConnsPerHost
+	if opts.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	return t
+}
+
+func closeIdle(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,156 @@
+package httpclient
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxBackoff caps how long a 429 pauses requests, whatever Retry-After
+// asks for, so a misbehaving server cannot stall a run indefinitely.
+const maxBackoff = 30 * time.Second
+
+// bucket is the rate limit shared by every transport, so it holds across
+// all phases and parallel streams. The token bucket starts full and holds
+// up to one second of requests, so short bursts pass and longer ones are
+// smoothed to the rate. A 429 with backoff enabled also pauses it.
+type bucket struct {
+	// limit is nil when only 429 backoff is enabled.
+	limit   *rate.Limiter
+	backoff bool
+
+	mu     sync.Mutex
+	paused time.Time
+}
+
+var (
+	limiter atomic.Pointer[bucket]
+
+	delayed  atomic.Int64
+	waited   atomic.Int64
+	backoffs atomic.Int64
+)
+
+// configureLimiter installs the bucket for opts, or none when neither a
+// rate nor 429 backoff is set.
+func configureLimiter(opts Options) {
+	if opts.RateLimit <= 0 && !opts.Backoff429 {
+		limiter.Store(nil)
+		return
+	}
+	b := &bucket{backoff: opts.Backoff429}
+	if opts.RateLimit > 0 {
+		burst := max(1, int(math.Ceil(opts.RateLimit)))
+		b.limit = rate.NewLimiter(rate.Limit(opts.RateLimit), burst)
+	}
+	limiter.Store(b)
+}
+
+// wait blocks until the caller's token is due and any 429 pause is over.
+// The token is reserved up front, so waiting callers queue in order, and
+// handed back when ctx ends first. Delays are counted for RateLimitStats.
+func (b *bucket) wait(ctx context.Context) error {
+	var d time.Duration
+	var r *rate.Reservation
+	if b.limit != nil {
+		r = b.limit.Reserve()
+		d = r.Delay()
+	}
+	b.mu.Lock()
+	d = max(d, time.Until(b.paused))
+	b.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	delayed.Add(1)
+	waited.Add(int64(d))
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if r != nil {
+			r.Cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// pause holds back every request until d from now, unless a longer pause
+// is already in place.
+func (b *bucket) pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.paused) {
+		b.paused = until
+	}
+}
+
+// RateLimitStats returns how many requests the rate limit or a 429 backoff
+// delayed, their total wait, and how many 429 responses caused a backoff.
+func RateLimitStats() (int64, time.Duration, int64) {
+	return delayed.Load(), time.Duration(waited.Load()), backoffs.Load()
+}
+
+type admittedKey struct{}
+
+// Admit waits for the rate limit ahead of a timed request and marks ctx so
+// the transport does not wait again. A probe that starts its clock after
+// Admit keeps the wait out of its latency.
+func Admit(ctx context.Context) (context.Context, error) {
+	b := limiter.Load()
+	if b == nil {
+		return ctx, nil
+	}
+	if err := b.wait(ctx); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, admittedKey{}, true), nil
+}
+
+// limitedTransport makes every request wait for the shared bucket, unless
+// its context went through Admit.
+type limitedTransport struct {
+	http.RoundTripper
+}
+
+func (t limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := limiter.Load()
+	if b == nil {
+		return t.RoundTripper.RoundTrip(req)
+	}
+	if req.Context().Value(admittedKey{}) == nil {
+		if err := b.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests && b.backoff {
+		backoffs.Add(1)
+		b.pause(retryAfter(resp.Header.Get("Retry-After")))
+	}
+	return resp, err
+}
+
+func (t limitedTransport) CloseIdleConnections() {
+	closeIdle(t.RoundTripper)
+}
+
+// retryAfter reads a Retry-After value in seconds or as an HTTP date,
+// defaulting to one second and capped at maxBackoff.
+func retryAfter(v string) time.Duration {
+	d := time.Second
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	}
+	return min(max(d, time.Second), maxBackoff)
+}
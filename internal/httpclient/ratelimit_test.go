@@ -0,0 +1,39 @@
+package httpclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdmitRateLimit(t *testing.T) {
+	configureLimiter(Options{RateLimit: 20})
+	t.Cleanup(func() { configureLimiter(Options{}) })
+
+	// The first second's worth passes at once; the ten after it are
+	// spaced 50ms apart.
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		if _, err := Admit(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond || elapsed > 700*time.Millisecond {
+		t.Errorf("30 requests at 20/s with a burst of 20 took %v, want about 500ms", elapsed)
+	}
+
+	// A caller that gives up hands its token back rather than delaying
+	// the ones queued after it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := Admit(ctx); err == nil {
+		t.Fatal("Admit succeeded past its deadline")
+	}
+	start = time.Now()
+	if _, err := Admit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("request after a cancelled one waited %v, want at most one interval", elapsed)
+	}
+}
@@ -0,0 +1,164 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+	"sync"
+)
+
+// DefaultFallbackResolvers is empty: falling back sends the test host names
+// to a third party, so it happens only when resolvers are given.
+const DefaultFallbackResolvers = ""
+
+// ParseResolvers parses a comma-separated list of resolver addresses, each
+// an IP with an optional port (53 by default). An empty list or "none"
+// disables the fallback.
+func ParseResolvers(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, port = strings.Trim(entry, "[]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid resolver %q: use an IP address, optionally with a port", entry)
+		}
+		list = append(list, net.JoinHostPort(host, port))
+	}
+	return list, nil
+}
+
+// ParseResolve parses a host:ip override, as taken by curl's --resolve
+// without the port. An IPv6 address may be given with or without
+// brackets.
+func ParseResolve(s string) (host, ip string, err error) {
+	host, ip, ok := strings.Cut(strings.TrimSpace(s), ":")
+	ip = strings.Trim(ip, "[]")
+	if !ok || host == "" || net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("invalid override %q: want host:ip, e.g. example.com:192.0.2.10", s)
+	}
+	return strings.ToLower(host), ip, nil
+}
+
+// pinnedAddr rewrites addr to the pinned IP of its host, if it has one.
+func pinnedAddr(pins map[string]string, addr string) (string, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, false
+	}
+	ip, ok := pins[strings.ToLower(host)]
+	if !ok {
+		return addr, false
+	}
+	return net.JoinHostPort(ip, port), true
+}
+
+var (
+	fallbackMu      sync.Mutex
+	fallbackAnswers = map[string]string{}
+)
+
+// FallbackAnswers returns, for each host the system resolver failed on,
+// the fallback resolver that answered instead.
+func FallbackAnswers() map[string]string {
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+	if len(fallbackAnswers) == 0 {
+		return nil
+	}
+	return maps.Clone(fallbackAnswers)
+}
+
+// fellBack reports whether the host of addr was already resolved by a
+// fallback resolver.
+func fellBack(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+	_, ok := fallbackAnswers[host]
+	return ok
+}
+
+// LookupFallback resolves host with each of the configured fallback
+// resolvers in turn and returns the addresses from the first that answers,
+// along with that resolver. network is "ip", "ip4" or "ip6".
+func LookupFallback(ctx context.Context, network, host string) ([]net.IP, string, error) {
+	return lookupFallback(ctx, Current().FallbackResolvers, network, host)
+}
+
+func lookupFallback(ctx context.Context, servers []string, network, host string) ([]net.IP, string, error) {
+	if len(servers) == 0 {
+		return nil, "", errors.New("no fallback resolvers configured")
+	}
+	var lastErr error
+	for _, server := range servers {
+		ips, err := resolverFor(server).LookupIP(ctx, network, host)
+		if err == nil {
+			fallbackMu.Lock()
+			fallbackAnswers[host] = server
+			fallbackMu.Unlock()
+			return ips, server, nil
+		}
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
+
+// resolverFor returns a pure-Go resolver that sends every query to server
+// instead of the system's configured name servers.
+func resolverFor(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// dialFallback is called when dialing addr failed because its host could
+// not be resolved, or when it failed before. It resolves the host with the
+// fallback resolvers and dials the addresses they return, returning dnsErr,
+// or the resolvers' error when dnsErr is nil, when none answers.
+func dialFallback(ctx context.Context, dial func(context.Context, string, string) (net.Conn, error),
+	servers []string, network, addr string, dnsErr error) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, dnsErr
+	}
+	lookup := "ip"
+	switch network {
+	case "tcp4":
+		lookup = "ip4"
+	case "tcp6":
+		lookup = "ip6"
+	}
+	ips, _, err := lookupFallback(ctx, servers, lookup, host)
+	if err != nil {
+		if dnsErr == nil {
+			return nil, err
+		}
+		return nil, dnsErr
+	}
+	err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
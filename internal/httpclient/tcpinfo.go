@@ -0,0 +1,41 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// TCPInfo is the kernel's view of a TCP connection. Retransmits counts the
+// segments this host has retransmitted over the connection's lifetime;
+// RTT and RTTVar are the kernel's smoothed round-trip estimate and its
+// variance.
+type TCPInfo struct {
+	Retransmits uint32
+	RTT         time.Duration
+	RTTVar      time.Duration
+}
+
+var errNoTCPInfo = errors.New("TCP_INFO is not available on this platform")
+
+// ReadTCPInfo returns the socket statistics of a connection opened through
+// this package, as handed out by httptrace.GotConnInfo. It fails for
+// HTTP/3 and on platforms without TCP_INFO.
+func ReadTCPInfo(c net.Conn) (TCPInfo, error) {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if cc, ok := c.(countingConn); ok {
+		c = cc.Conn
+	}
+	tcp, ok := c.(*net.TCPConn)
+	if !ok {
+		return TCPInfo{}, errors.New("not a TCP connection")
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return TCPInfo{}, err
+	}
+	return tcpInfo(raw)
+}
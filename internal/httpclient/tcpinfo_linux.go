@@ -0,0 +1,33 @@
+//go:build linux && !386
+
+package httpclient
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func tcpInfo(c syscall.RawConn) (TCPInfo, error) {
+	var info syscall.TCPInfo
+	size := uint32(unsafe.Sizeof(info))
+	var errno syscall.Errno
+	err := c.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd,
+			syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil {
+		return TCPInfo{}, err
+	}
+	if errno != 0 {
+		return TCPInfo{}, errno
+	}
+
+	// The kernel reports both round-trip figures in microseconds.
+	return TCPInfo{
+		Retransmits: info.Total_retrans,
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:      time.Duration(info.Rttvar) * time.Microsecond,
+	}, nil
+}
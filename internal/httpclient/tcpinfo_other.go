@@ -0,0 +1,12 @@
+//go:build !linux || 386
+
+package httpclient
+
+import "syscall"
+
+// On linux/386 getsockopt goes through socketcall, which package syscall
+// does not expose, so TCP_INFO is reported as unavailable there too.
+
+func tcpInfo(syscall.RawConn) (TCPInfo, error) {
+	return TCPInfo{}, errNoTCPInfo
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import "time"
+
+// windowBoundRatio is how close to the window limit a connection must come
+// to count as held back by it rather than by the link.
+const windowBoundRatio = 0.8
+
+// WindowLimit compares the fastest connection of a download with the most
+// a single TCP stream can carry: one receive window per round trip. On
+// long-haul links that ceiling is low (a 4MB window at 150ms allows about
+// 224 Mbps), so one connection cannot fill a fast pipe however good the
+// link is.
+type WindowLimit struct {
+	Window  int64
+	RTT     time.Duration
+	MaxMbps float64
+
+	FastestMbps float64
+	Connections int
+
+	// Bound is set when the fastest connection came within
+	// windowBoundRatio of MaxMbps. A connection well above it means the
+	// real window is larger than assumed, so it does not count.
+	Bound bool
+}
+
+// CheckWindowLimit returns the window limit for window bytes at rtt and
+// compares it with the per-connection speeds of a download, or nil when
+// either is unknown.
+func CheckWindowLimit(window int64, rtt time.Duration, speeds []float64) *WindowLimit {
+	if window <= 0 || rtt <= 0 || len(speeds) == 0 {
+		return nil
+	}
+	w := &WindowLimit{
+		Window:      window,
+		RTT:         rtt,
+		MaxMbps:     float64(window*8) / 1_000_000 / rtt.Seconds(),
+		Connections: len(speeds),
+	}
+	for _, s := range speeds {
+		w.FastestMbps = max(w.FastestMbps, s)
+	}
+	w.Bound = w.FastestMbps >= windowBoundRatio*w.MaxMbps && w.FastestMbps <= w.MaxMbps/windowBoundRatio
+	return w
+}
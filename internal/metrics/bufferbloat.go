@@ -2,69 +2,305 @@ package metrics
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
 )
 
 type BufferbloatResult struct {
-	LatencyUnderLoad   time.Duration
-	LatencyIdle        time.Duration
-	BloatDelta         time.Duration
-	Severity           string
+	LatencyUnderLoad time.Duration
+	LatencyIdle      time.Duration
+	BloatDelta       time.Duration
+	Severity         string
+	RPM              float64
+	Responsiveness   string
+
+	// Direction is the load the latency was measured under: BloatDown,
+	// BloatUp or BloatBoth.
+	Direction string
 }
 
+// Directions of the background load in a bufferbloat measurement.
+const (
+	BloatDown = "down"
+	BloatUp   = "up"
+	BloatBoth = "both"
+)
+
+const (
+	bloatWarmups = 2
+	bloatSamples = 5
+	bloatStreams = 10
+
+	// uploadChunk is the body size of each upload load request; a stream
+	// posts one after another until the load stops.
+	uploadChunk = 8 << 20
+)
+
 func MeasureBufferbloat(ctx context.Context, url string) (*BufferbloatResult, error) {
-	idleLatency, err := measureSingleLatency(ctx, url)
+	return MeasureBufferbloatLimit(ctx, url, 0)
+}
+
+// MeasureBufferbloatLimit is MeasureBufferbloat with the background load
+// stopped once it has downloaded maxBytes, when maxBytes is above 0. The
+// under-load probes still run, but may see less queuing once it stops.
+func MeasureBufferbloatLimit(ctx context.Context, url string, maxBytes int64) (*BufferbloatResult, error) {
+	results, err := MeasureBufferbloatDirections(ctx, url, "", []string{BloatDown}, maxBytes)
 	if err != nil {
 		return nil, err
 	}
+	return results[0], nil
+}
+
+// MeasureBufferbloatDirections measures the idle latency to url once and
+// then the latency under each load direction in turn: BloatDown downloads
+// url, BloatUp posts to uploadURL and BloatBoth does both at once. The
+// maxBytes limit, counting bytes in either direction, is split evenly
+// between the directions.
+func MeasureBufferbloatDirections(ctx context.Context, url, uploadURL string, dirs []string, maxBytes int64) ([]*BufferbloatResult, error) {
+	probe := httpclient.New(5 * time.Second)
+	defer probe.CloseIdleConnections()
+
+	// A cold request pays for DNS, TCP and TLS setup, which would inflate
+	// the idle figure and hide real queuing delay, so establish a pooled
+	// connection first and compare medians of warm samples.
+	for i := 0; i < bloatWarmups; i++ {
+		probeLatency(ctx, probe, url)
+	}
+
+	idleLatency, err := medianLatency(ctx, probe, url, bloatSamples)
+	if err != nil {
+		return nil, wrapError("bufferbloat: idle latency", err)
+	}
 
+	results := make([]*BufferbloatResult, 0, len(dirs))
+	for _, dir := range dirs {
+		limit := maxBytes / int64(len(dirs))
+		if maxBytes > 0 && limit == 0 {
+			limit = 1
+		}
+		underLoadLatency, err := latencyUnderLoad(ctx, probe, url, uploadURL, dir, limit)
+		if err != nil {
+			return nil, wrapError("bufferbloat: latency under "+dir+" load", err)
+		}
+		results = append(results, bloatResult(dir, idleLatency, underLoadLatency))
+	}
+	return results, nil
+}
+
+// latencyUnderLoad runs the background load for dir and returns the median
+// probe latency while it flows.
+func latencyUnderLoad(ctx context.Context, probe *http.Client, url, uploadURL, dir string, maxBytes int64) (time.Duration, error) {
+	loadCtx, stopLoad := context.WithCancel(ctx)
+	var moved atomic.Int64
 	var wg sync.WaitGroup
-	client := &http.Client{Timeout: 5 * time.Second}
-	
-	for i := 0; i < 10; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-			client.Do(req)
-		}()
+	started := make(chan struct{}, 2*bloatStreams)
+
+	// The load has a transport of its own, so its requests never take the
+	// probe's warm connection from the pool, nor share it over HTTP/2.
+	client := &http.Client{Timeout: 5 * time.Second, Transport: httpclient.NewTransport(2 * bloatStreams)}
+
+	count := func(n int) {
+		if maxBytes > 0 && moved.Add(int64(n)) >= maxBytes {
+			stopLoad()
+		}
+	}
+
+	if dir == BloatDown || dir == BloatBoth {
+		for i := 0; i < bloatStreams; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				downloadLoad(loadCtx, client, url, started, count)
+			}()
+		}
+	}
+	if dir == BloatUp || dir == BloatBoth {
+		for i := 0; i < bloatStreams; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				uploadLoad(loadCtx, client, uploadURL, started, count)
+			}()
+		}
 	}
+
+	// Probe once the load is actually flowing, then tear it down and wait
+	// for every load goroutine so no request outlives this call, nor a
+	// connection it left in the pool.
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+	}
+	latency, err := medianLatency(ctx, probe, url, bloatSamples)
+	stopLoad()
 	wg.Wait()
+	client.CloseIdleConnections()
+	return latency, err
+}
 
-	underLoadLatency, err := measureSingleLatency(ctx, url)
+func downloadLoad(ctx context.Context, client *http.Client, url string, started chan<- struct{}, count func(int)) {
+	req, err := httpclient.NewRequest(ctx, "GET", url)
 	if err != nil {
-		return nil, err
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	started <- struct{}{}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		count(n)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// uploadLoad posts uploadChunk bodies to url back to back until ctx ends
+// or a request fails.
+func uploadLoad(ctx context.Context, client *http.Client, url string, started chan<- struct{}, count func(int)) {
+	var once sync.Once
+	for ctx.Err() == nil {
+		req, err := httpclient.NewRequest(ctx, "POST", url)
+		if err != nil {
+			return
+		}
+		body := &uploadBody{remaining: uploadChunk, count: func(n int) {
+			once.Do(func() { started <- struct{}{} })
+			count(n)
+		}}
+		req.Body = io.NopCloser(body)
+		req.ContentLength = uploadChunk
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
 	}
+}
 
-	delta := underLoadLatency - idleLatency
-	severity := "Low"
-	if delta > 100*time.Millisecond {
-		severity = "Medium"
+// uploadBody yields remaining zero bytes.
+type uploadBody struct {
+	remaining int64
+	count     func(int)
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
 	}
-	if delta > 300*time.Millisecond {
-		severity = "High"
+	clear(p)
+	b.remaining -= int64(len(p))
+	b.count(len(p))
+	return len(p), nil
+}
+
+// BloatSeverity rates how much latency rose under load: Low up to 100ms,
+// Medium up to 300ms, High above.
+func BloatSeverity(delta time.Duration) string {
+	switch {
+	case delta > 300*time.Millisecond:
+		return "High"
+	case delta > 100*time.Millisecond:
+		return "Medium"
+	default:
+		return "Low"
 	}
+}
+
+func bloatResult(dir string, idleLatency, underLoadLatency time.Duration) *BufferbloatResult {
+	delta := underLoadLatency - idleLatency
+	severity := BloatSeverity(delta)
+
+	rpm := ResponsivenessRPM(underLoadLatency)
 
 	return &BufferbloatResult{
 		LatencyUnderLoad: underLoadLatency,
 		LatencyIdle:      idleLatency,
 		BloatDelta:       delta,
 		Severity:         severity,
-	}, nil
+		RPM:              rpm,
+		Responsiveness:   ResponsivenessBand(rpm),
+		Direction:        dir,
+	}
 }
 
-func measureSingleLatency(ctx context.Context, url string) (time.Duration, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	start := time.Now()
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// ResponsivenessRPM expresses a loaded round trip as round-trips per
+// minute, the unit used by Apple's networkQuality.
+func ResponsivenessRPM(loadedRTT time.Duration) float64 {
+	ms := float64(loadedRTT) / float64(time.Millisecond)
+	if ms <= 0 {
+		return 0
+	}
+	return 60000 / ms
+}
+
+func ResponsivenessBand(rpm float64) string {
+	switch {
+	case rpm >= 1000:
+		return "High"
+	case rpm >= 300:
+		return "Medium"
+	default:
+		return "Low"
+	}
+}
+
+func medianLatency(ctx context.Context, client *http.Client, url string, samples int) (time.Duration, error) {
+	latencies := make([]time.Duration, 0, samples)
+	var lastErr error
+	for i := 0; i < samples; i++ {
+		latency, err := probeLatency(ctx, client, url)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+
+	if len(latencies) == 0 {
+		return 0, lastErr
+	}
+	return Median(latencies), nil
+}
+
+// probeLatency times a HEAD request so the connection can return to the
+// pool without downloading the test file.
+func probeLatency(ctx context.Context, client *http.Client, url string) (time.Duration, error) {
+	ctx, err := httpclient.Admit(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req, err := httpclient.NewRequest(ctx, "HEAD", url)
 	if err != nil {
 		return 0, err
 	}
-	_, err = client.Do(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, err
 	}
-	return time.Since(start), nil
+	latency := time.Since(start)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return latency, nil
 }
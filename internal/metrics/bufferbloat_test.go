@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestBufferbloatNoLeaks(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel time.Duration
+	}{
+		{"completes", 0},
+		{"cancelled under load", 900 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+			// HEAD is answered after 100ms and GET streams until the client
+			// goes away, as a large test file would. The seven idle probes
+			// take about 700ms, after which the load runs for the five
+			// loaded ones.
+			buf := make([]byte, 32*1024)
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					time.Sleep(100 * time.Millisecond)
+					return
+				}
+				for r.Context().Err() == nil {
+					if _, err := w.Write(buf); err != nil {
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}))
+			var open atomic.Int64
+			closed := make(chan struct{}, 1)
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				switch state {
+				case http.StateNew:
+					open.Add(1)
+				case http.StateClosed, http.StateHijacked:
+					open.Add(-1)
+					select {
+					case closed <- struct{}{}:
+					default:
+					}
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel > 0 {
+				time.AfterFunc(tt.cancel, cancel)
+			}
+			start := time.Now()
+			MeasureBufferbloat(ctx, srv.URL)
+			if tt.cancel > 0 {
+				if elapsed := time.Since(start); elapsed > tt.cancel+300*time.Millisecond {
+					t.Errorf("returned %v after cancellation", elapsed-tt.cancel)
+				}
+			}
+
+			// Every connection must be closed by the client before the
+			// server is, or the goroutine check would not see it: closing
+			// the server ends the client's side of the connection too.
+			timeout := time.After(2 * time.Second)
+			for open.Load() > 0 {
+				select {
+				case <-closed:
+				case <-timeout:
+					t.Fatalf("%d connections left open", open.Load())
+				}
+			}
+		})
+	}
+}
+
+// TestBufferbloatProbeStaysWarm checks that the load opens connections of
+// its own and leaves the probe's warm one alone: a load request that took
+// it would make the probe dial anew under load, adding a handshake to the
+// loaded latency.
+func TestBufferbloatProbeStaysWarm(t *testing.T) {
+	buf := make([]byte, 32*1024)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for r.Method != http.MethodHead && r.Context().Err() == nil {
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	var dials atomic.Int64
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	if _, err := MeasureBufferbloat(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if n := dials.Load(); n != 1+bloatStreams {
+		t.Errorf("%d connections opened, want one for the probes and %d for the load", n, bloatStreams)
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"time"
+)
+
+// ConnectResult counts how many of a series of fresh TCP connections to a
+// host succeeded. Failures is keyed by reason: dns, refused, reset,
+// unreachable, timeout or other.
+type ConnectResult struct {
+	Addr      string
+	Attempts  int
+	Successes int
+	Failures  map[string]int
+	Min       time.Duration
+	Median    time.Duration
+	Max       time.Duration
+
+	// Times holds the handshake time of each successful attempt, in order.
+	Times []time.Duration
+}
+
+// SuccessRate returns the percentage of attempts that connected.
+func (r *ConnectResult) SuccessRate() float64 {
+	if r.Attempts == 0 {
+		return 0
+	}
+	return float64(r.Successes) / float64(r.Attempts) * 100
+}
+
+// ConnectTest opens attempts TCP connections to the host and port of
+// rawURL one after another, interval apart, and closes each as soon as
+// the handshake completes. The host name is resolved for every attempt,
+// so an unreliable resolver shows up as dns failures. Unlike jitter, which
+// measures how long requests take, this only asks whether connection
+// setup works at all.
+func ConnectTest(ctx context.Context, rawURL string, attempts int, interval, timeout time.Duration) (*ConnectResult, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	r := &ConnectResult{
+		Addr:     net.JoinHostPort(u.Hostname(), port),
+		Failures: make(map[string]int),
+	}
+	var d net.Dialer
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return r, nil
+			case <-time.After(interval):
+			}
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		conn, err := d.DialContext(dialCtx, "tcp", r.Addr)
+		elapsed := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			break
+		}
+
+		r.Attempts++
+		if err != nil {
+			r.Failures[connectFailure(err)]++
+			continue
+		}
+		conn.Close()
+		r.Successes++
+		r.Times = append(r.Times, elapsed)
+		if r.Successes == 1 || elapsed < r.Min {
+			r.Min = elapsed
+		}
+		if elapsed > r.Max {
+			r.Max = elapsed
+		}
+	}
+
+	r.Median = Median(r.Times)
+	return r, nil
+}
+
+func connectFailure(err error) string {
+	switch errorKind(err) {
+	case ErrDNS:
+		return "dns"
+	case ErrConnRefused:
+		return "refused"
+	case ErrConnReset:
+		return "reset"
+	case ErrUnreachable:
+		return "unreachable"
+	case ErrTimeout:
+		return "timeout"
+	}
+	return "other"
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// Connection stages in the order Diagnose walks through them. Stage names
+// the first one that failed, or StageOK when a request got a response.
+const (
+	StageDNS     = "dns"
+	StageConnect = "connect"
+	StageTLS     = "tls"
+	StageHTTP    = "http"
+	StageOK      = "ok"
+)
+
+type Diagnostics struct {
+	Host       string
+	Addr       string
+	DNS        time.Duration
+	Connect    time.Duration
+	TLS        time.Duration
+	StatusCode int
+	Stage      string
+	Error      string
+
+	// Resolver is the fallback resolver that answered when the system
+	// resolver failed, or empty.
+	Resolver string
+}
+
+// Diagnose retraces a connection to url one step at a time so a failed
+// test can report how far it got: DNS resolution, TCP connect, the TLS
+// handshake for https URLs, and finally a HEAD request.
+func Diagnose(ctx context.Context, rawURL string, timeout time.Duration) *Diagnostics {
+	d := &Diagnostics{Stage: StageDNS}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		d.Error = fmt.Sprintf("invalid URL %q", rawURL)
+		return d
+	}
+	d.Host = u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var ips []net.IP
+	if pin, ok := httpclient.Current().Resolve[strings.ToLower(d.Host)]; ok {
+		ips = []net.IP{net.ParseIP(pin)}
+	} else {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", d.Host)
+	}
+	if err != nil && len(httpclient.Current().FallbackResolvers) > 0 {
+		var fallbackErr error
+		ips, d.Resolver, fallbackErr = httpclient.LookupFallback(ctx, "ip", d.Host)
+		if fallbackErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.DNS = time.Since(start)
+
+	d.Stage = StageConnect
+	d.Addr = net.JoinHostPort(ips[0].String(), port)
+	var dialer net.Dialer
+	start = time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", d.Addr)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.Connect = time.Since(start)
+	defer conn.Close()
+
+	if u.Scheme == "https" {
+		d.Stage = StageTLS
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.Host})
+		start = time.Now()
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			d.Error = err.Error()
+			return d
+		}
+		d.TLS = time.Since(start)
+	}
+
+	d.Stage = StageHTTP
+	req, err := httpclient.NewRequest(ctx, "HEAD", rawURL)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	resp, err := httpclient.New(timeout).Do(req)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	resp.Body.Close()
+
+	d.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 400 {
+		d.Error = resp.Status
+		return d
+	}
+	d.Stage = StageOK
+	return d
+}
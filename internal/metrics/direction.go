@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// DirectionBodyBytes is the size of the body the direction probe uploads.
+// It is larger than a typical initial congestion window, so it takes more
+// than one flight to send, yet small enough not to load the link.
+const DirectionBodyBytes = 64 * 1024
+
+// directionMaxRead bounds what is read of a response whose server ignored
+// the Range header and sent a whole test file.
+const directionMaxRead = 64 * 1024
+
+// Timing splits a request at the moment its last byte was written: Write
+// is from getting the connection to that moment, Wait from there to the
+// first byte of the response.
+type Timing struct {
+	Write time.Duration
+	Wait  time.Duration
+}
+
+func (t Timing) Total() time.Duration {
+	return t.Write + t.Wait
+}
+
+// DirectionResult compares a minimal GET with a POST carrying
+// DirectionBodyBytes on the same warm connection. Both pay the same round
+// trip and server time, so what the POST adds is roughly the cost of
+// pushing the body upstream. It is a hint rather than a measurement: the
+// kernel buffers part of the body, servers may answer before reading it,
+// and slow start adds round trips that are not upstream capacity.
+type DirectionResult struct {
+	Get       Timing
+	Post      Timing
+	BodyBytes int
+	Samples   int
+
+	// UploadCost is the median extra time of the POST over the GET, and
+	// UpstreamMbps the upstream rate it implies.
+	UploadCost   time.Duration
+	UpstreamMbps float64
+}
+
+// Bottleneck compares the upstream rate the probe implies with a measured
+// download rate and names the direction that looks slower by more than a
+// factor of two: "upstream", "downstream" or "balanced". It returns "" when
+// either rate is unknown.
+func (d *DirectionResult) Bottleneck(downloadMbps float64) string {
+	if d.UpstreamMbps <= 0 || downloadMbps <= 0 {
+		return ""
+	}
+	switch {
+	case d.UpstreamMbps*2 < downloadMbps:
+		return "upstream"
+	case downloadMbps*2 < d.UpstreamMbps:
+		return "downstream"
+	default:
+		return "balanced"
+	}
+}
+
+// MeasureDirection alternates samples single-byte range GETs to url and
+// POSTs of DirectionBodyBytes to postURL, after one request of each to warm
+// the connection, and compares their median timings. The response status is
+// ignored: a 405 for the POST still shows how long the body took to send.
+func MeasureDirection(ctx context.Context, url, postURL string, samples int) (*DirectionResult, error) {
+	client := httpclient.New(10 * time.Second)
+	body := make([]byte, DirectionBodyBytes)
+
+	var getWrites, getWaits, postWrites, postWaits, costs []time.Duration
+	var lastErr error
+	for i := -1; i < samples; i++ {
+		get, err := timeRequest(ctx, client, "GET", url, nil)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		post, err := timeRequest(ctx, client, "POST", postURL, body)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if i < 0 {
+			continue
+		}
+		getWrites = append(getWrites, get.Write)
+		getWaits = append(getWaits, get.Wait)
+		postWrites = append(postWrites, post.Write)
+		postWaits = append(postWaits, post.Wait)
+		costs = append(costs, post.Total()-get.Total())
+	}
+
+	if len(costs) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no samples")
+		}
+		return nil, lastErr
+	}
+
+	r := &DirectionResult{
+		Get:        Timing{Write: Median(getWrites), Wait: Median(getWaits)},
+		Post:       Timing{Write: Median(postWrites), Wait: Median(postWaits)},
+		BodyBytes:  DirectionBodyBytes,
+		Samples:    len(costs),
+		UploadCost: max(Median(costs), 0),
+	}
+	if r.UploadCost > 0 {
+		r.UpstreamMbps = float64(DirectionBodyBytes*8) / 1_000_000 / r.UploadCost.Seconds()
+	}
+	return r, nil
+}
+
+func timeRequest(ctx context.Context, client *http.Client, method, url string, body []byte) (Timing, error) {
+	var got, wrote, first time.Time
+	trace := &httptrace.ClientTrace{
+		GotConn:              func(httptrace.GotConnInfo) { got = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { first = time.Now() },
+	}
+	req, err := httpclient.NewRequest(httptrace.WithClientTrace(ctx, trace), method, url)
+	if err != nil {
+		return Timing{}, err
+	}
+	if body == nil {
+		req.Header.Set("Range", "bytes=0-0")
+	} else {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Timing{}, err
+	}
+	// Only the first byte matters; cutting off an oversized body costs the
+	// connection, not the sample.
+	io.CopyN(io.Discard, resp.Body, directionMaxRead)
+	resp.Body.Close()
+
+	if wrote.IsZero() || first.IsZero() {
+		return Timing{}, fmt.Errorf("incomplete request trace")
+	}
+	return Timing{Write: wrote.Sub(got), Wait: first.Sub(wrote)}, nil
+}
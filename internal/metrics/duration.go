@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatDuration renders a measured duration for people with a unit that
+// suits its size and a fixed precision: 850µs, 12.3ms, 1.25s, 2m5s. All
+// text output uses it so figures line up and never collapse to 0s.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+	// Each unit is chosen after rounding to its precision, so 999.96ms
+	// becomes 1.00s rather than 1000.0ms.
+	switch {
+	case d == 0:
+		return "0s"
+	case d < time.Microsecond:
+		return d.String()
+	case d.Round(time.Microsecond) < time.Millisecond:
+		return fmt.Sprintf("%.0fµs", float64(d)/float64(time.Microsecond))
+	case d.Round(100*time.Microsecond) < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	case d.Round(10*time.Millisecond) < time.Minute:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{500 * time.Nanosecond, "500ns"},
+		{850 * time.Microsecond, "850µs"},
+		{999_600 * time.Nanosecond, "1.0ms"},
+		{12_340 * time.Microsecond, "12.3ms"},
+		{999_960 * time.Microsecond, "1.00s"},
+		{1250 * time.Millisecond, "1.25s"},
+		{125 * time.Second, "2m5s"},
+		{-850 * time.Microsecond, "-850µs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatDuration(tt.d); got != tt.want {
+				t.Errorf("FormatDuration(%d) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
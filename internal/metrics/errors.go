@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Failure categories for errors from the measurements. The *Error they
+// return wraps one of these along with the underlying cause, so callers can
+// test the category with errors.Is and still reach the cause, such as a
+// *net.DNSError, with errors.As.
+var (
+	ErrDNS         = errors.New("DNS lookup failed")
+	ErrConnRefused = errors.New("connection refused")
+	ErrConnReset   = errors.New("connection reset")
+	ErrUnreachable = errors.New("host unreachable")
+	ErrTimeout     = errors.New("timed out")
+	ErrTLS         = errors.New("TLS handshake failed")
+)
+
+// errorKind returns the category of err, or nil when it fits none. A DNS
+// lookup that timed out counts as a DNS failure, since the resolver rather
+// than the target is at fault.
+func errorKind(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &dnsErr):
+		return ErrDNS
+	case isTLSError(err):
+		return ErrTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrConnRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrConnReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ErrUnreachable
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	}
+	return nil
+}
+
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostErr      x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostErr) || errors.As(err, &invalidErr)
+}
+
+// Error is a failed measurement. Op names it, e.g. "latency", and Kind is
+// one of the categories above, or nil when the cause fits none. errors.Is
+// matches both Kind and the causes in Err.
+type Error struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Op, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// wrapError returns err as an *Error for op, with its category.
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Kind: errorKind(err), Err: err}
+}
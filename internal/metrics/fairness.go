@@ -0,0 +1,32 @@
+package metrics
+
+// JainIndex is Jain's fairness index of xs: (Σx)² / (n·Σx²). It is 1 when
+// every value is equal and falls towards 1/n as a single value takes
+// everything. It is 0 for an empty or all-zero xs.
+func JainIndex(xs []float64) float64 {
+	var sum, sumSq float64
+	for _, x := range xs {
+		sum += x
+		sumSq += x * x
+	}
+	if sumSq == 0 {
+		return 0
+	}
+	return sum * sum / (float64(len(xs)) * sumSq)
+}
+
+// FairnessNote interprets the Jain index of the per-connection speeds of a
+// download. Parallel connections over one path should share it about
+// evenly; when a few dominate, the server or something on the path is
+// treating the flows unequally, such as per-flow shaping or unequal
+// routing of load-balanced paths.
+func FairnessNote(index float64) string {
+	switch {
+	case index >= 0.9:
+		return "connections shared the bandwidth evenly"
+	case index >= 0.7:
+		return "some connections got noticeably more bandwidth than others"
+	default:
+		return "a few connections dominated; on a single path this points to per-flow shaping or a server-side limit"
+	}
+}
@@ -1,93 +1,308 @@
 package metrics
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
 	"time"
 )
 
+type GradeBand struct {
+	Grade    string `json:"grade"`
+	MinScore int    `json:"min_score"`
+	Level    string `json:"level"`
+	Value    int    `json:"value"`
+}
+
+type GradeScale struct {
+	Name  string      `json:"name"`
+	Bands []GradeBand `json:"bands"`
+}
+
+var DefaultGradeScale = GradeScale{
+	Name: "letter",
+	Bands: []GradeBand{
+		{Grade: "A", MinScore: 90, Level: "Gold", Value: 5},
+		{Grade: "B", MinScore: 75, Level: "Silver", Value: 4},
+		{Grade: "C", MinScore: 60, Level: "Bronze", Value: 3},
+		{Grade: "D", MinScore: 40, Level: "Basic", Value: 2},
+		{Grade: "F", MinScore: 0, Level: "Basic", Value: 1},
+	},
+}
+
+var GradeScales = map[string]GradeScale{
+	"letter": DefaultGradeScale,
+	"words": {
+		Name: "words",
+		Bands: []GradeBand{
+			{Grade: "Excellent", MinScore: 90, Level: "Excellent", Value: 5},
+			{Grade: "Good", MinScore: 75, Level: "Good", Value: 4},
+			{Grade: "Fair", MinScore: 60, Level: "Fair", Value: 3},
+			{Grade: "Poor", MinScore: 40, Level: "Poor", Value: 2},
+			{Grade: "Bad", MinScore: 0, Level: "Bad", Value: 1},
+		},
+	},
+	"pass-fail": {
+		Name: "pass-fail",
+		Bands: []GradeBand{
+			{Grade: "PASS", MinScore: 60, Level: "Pass", Value: 2},
+			{Grade: "FAIL", MinScore: 0, Level: "Fail", Value: 1},
+		},
+	},
+}
+
+// LoadGradeScale resolves a preset name or, failing that, reads a JSON
+// scale definition from the given path.
+func LoadGradeScale(nameOrPath string) (GradeScale, error) {
+	if scale, ok := GradeScales[nameOrPath]; ok {
+		return scale, nil
+	}
+
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return GradeScale{}, fmt.Errorf("unknown grade scale %q", nameOrPath)
+	}
+
+	var scale GradeScale
+	if err := json.Unmarshal(data, &scale); err != nil {
+		return GradeScale{}, fmt.Errorf("grade scale %s: %w", nameOrPath, err)
+	}
+	if len(scale.Bands) == 0 {
+		return GradeScale{}, fmt.Errorf("grade scale %s: no bands defined", nameOrPath)
+	}
+
+	sort.Slice(scale.Bands, func(i, j int) bool {
+		return scale.Bands[i].MinScore > scale.Bands[j].MinScore
+	})
+	return scale, nil
+}
+
+func (s GradeScale) bands() []GradeBand {
+	if len(s.Bands) == 0 {
+		return DefaultGradeScale.Bands
+	}
+	return s.Bands
+}
+
+func (s GradeScale) Grades() []string {
+	bands := s.bands()
+	grades := make([]string, len(bands))
+	for i, b := range bands {
+		grades[i] = b.Grade
+	}
+	return grades
+}
+
+func (s GradeScale) ForScore(score int) GradeBand {
+	bands := s.bands()
+	for _, b := range bands {
+		if score >= b.MinScore {
+			return b
+		}
+	}
+	return bands[len(bands)-1]
+}
+
+func (s GradeScale) Band(grade string) (GradeBand, bool) {
+	for _, b := range s.bands() {
+		if b.Grade == grade {
+			return b, true
+		}
+	}
+	return GradeBand{}, false
+}
+
+// Rank returns the position of grade within the scale, 0 being the best,
+// or -1 if the grade is not part of it.
+func (s GradeScale) Rank(grade string) int {
+	for i, b := range s.bands() {
+		if b.Grade == grade {
+			return i
+		}
+	}
+	return -1
+}
+
 type HealthScore struct {
 	Grade        string
+	Level        string
+	GradeValue   int
 	Score        int
 	DownloadMbps float64
 	Jitter       time.Duration
 	Latency      time.Duration
 	Bufferbloat  string
 	Details      []string
+
+	JitterInsufficient bool
+
+	// Components is how Score adds up, in the order the points are
+	// awarded: bandwidth, latency, jitter, bufferbloat.
+	Components []ScoreComponent
 }
 
-func CalculateHealthScore(downloadMbps float64, jitter, latency time.Duration, bufferbloat string) *HealthScore {
-	score := 0
+// ScoreComponent is one part of a HealthScore: the measured Value, the
+// Bucket it fell into and the Points that earned out of Max. A component
+// the run did not measure has Measured unset and is left out of the score
+// and the Verdict.
+type ScoreComponent struct {
+	Name     string
+	Value    string
+	Bucket   string
+	Points   int
+	Max      int
+	Measured bool
+}
+
+// CalculateHealthScore grades a measurement. A zero downloadMbps or
+// latency, a nil jitterResult and an "Unknown" bufferbloat mean that part
+// was not measured: the score is then the share of the points available
+// from the parts that were, out of 100. A jitter result with too few valid
+// samples earns no jitter points, since a link that drops every probe has
+// no jitter to speak of.
+func CalculateHealthScore(downloadMbps float64, jitterResult *JitterResult, latency time.Duration, bufferbloat string, scale GradeScale) *HealthScore {
+	var jitter time.Duration
+	insufficient := jitterResult != nil && jitterResult.Insufficient
+	if jitterResult != nil {
+		jitter = jitterResult.Jitter
+	}
+
 	details := []string{}
 
-	if downloadMbps >= 100 {
-		score += 30
-	} else if downloadMbps >= 50 {
-		score += 20
-	} else if downloadMbps >= 25 {
-		score += 10
+	bw := ScoreComponent{Name: DetractorBandwidth, Max: 30, Measured: downloadMbps > 0, Value: "not measured", Bucket: "-"}
+	if bw.Measured {
+		bw.Value = fmt.Sprintf("%.2f Mbps", downloadMbps)
+	}
+	switch {
+	case downloadMbps >= 100:
+		bw.Points, bw.Bucket = 30, ">= 100 Mbps"
+	case downloadMbps >= 50:
+		bw.Points, bw.Bucket = 20, "50-100 Mbps"
+	case downloadMbps >= 25:
+		bw.Points, bw.Bucket = 10, "25-50 Mbps"
+	case bw.Measured:
+		bw.Bucket = "< 25 Mbps"
 	}
 
-	if latency < 50*time.Millisecond {
-		score += 25
+	lat := ScoreComponent{Name: DetractorLatency, Max: 25, Measured: latency > 0, Value: FormatDuration(latency)}
+	switch {
+	case latency < 50*time.Millisecond:
+		lat.Points, lat.Bucket = 25, "< 50ms"
 		details = append(details, "Excellent latency")
-	} else if latency < 100*time.Millisecond {
-		score += 15
+	case latency < 100*time.Millisecond:
+		lat.Points, lat.Bucket = 15, "50-100ms"
 		details = append(details, "Good latency")
-	} else if latency < 200*time.Millisecond {
-		score += 5
+	case latency < 200*time.Millisecond:
+		lat.Points, lat.Bucket = 5, "100-200ms"
 		details = append(details, "Moderate latency")
-	} else {
+	default:
+		lat.Bucket = ">= 200ms"
 		details = append(details, "High latency")
 	}
+	if !lat.Measured {
+		lat.Value, lat.Bucket, lat.Points = "not measured", "-", 0
+	}
 
-	if jitter < 5*time.Millisecond {
-		score += 25
+	jit := ScoreComponent{Name: DetractorJitter, Max: 25, Measured: jitterResult != nil, Value: FormatDuration(jitter)}
+	switch {
+	case insufficient:
+		jit.Value, jit.Bucket = "n/a", "no valid samples"
+		details = append(details, "Jitter unavailable (no valid samples)")
+	case jitter < 5*time.Millisecond:
+		jit.Points, jit.Bucket = 25, "< 5ms"
 		details = append(details, "Excellent jitter")
-	} else if jitter < 15*time.Millisecond {
-		score += 15
+	case jitter < 15*time.Millisecond:
+		jit.Points, jit.Bucket = 15, "5-15ms"
 		details = append(details, "Acceptable jitter")
-	} else if jitter < 30*time.Millisecond {
-		score += 5
+	case jitter < 30*time.Millisecond:
+		jit.Points, jit.Bucket = 5, "15-30ms"
 		details = append(details, "High jitter")
-	} else {
+	default:
+		jit.Bucket = ">= 30ms"
 		details = append(details, "Very high jitter")
 	}
+	if !jit.Measured {
+		jit.Value, jit.Bucket, jit.Points = "not measured", "-", 0
+	}
 
+	bloat := ScoreComponent{Name: DetractorBufferbloat, Max: 20, Measured: bufferbloat != "Unknown" && bufferbloat != "",
+		Value: bufferbloat, Bucket: bufferbloat}
 	switch bufferbloat {
 	case "Low":
-		score += 20
+		bloat.Points = 20
 		details = append(details, "Low bufferbloat")
 	case "Medium":
-		score += 10
+		bloat.Points = 10
 		details = append(details, "Moderate bufferbloat")
 	case "High":
-		score += 0
 		details = append(details, "High bufferbloat")
+	default:
+		bloat.Value, bloat.Bucket = "not measured", "-"
 	}
 
-	grade := "F"
-	if score >= 90 {
-		grade = "A"
-	} else if score >= 75 {
-		grade = "B"
-	} else if score >= 60 {
-		grade = "C"
-	} else if score >= 40 {
-		grade = "D"
+	components := []ScoreComponent{bw, lat, jit, bloat}
+	points, available := 0, 0
+	for _, c := range components {
+		if c.Measured {
+			points += c.Points
+			available += c.Max
+		}
 	}
+	score := 0
+	if available > 0 {
+		score = int(math.Round(float64(points) * 100 / float64(available)))
+	}
+	band := scale.ForScore(score)
 
 	return &HealthScore{
-		Grade:        grade,
+		Grade:        band.Grade,
+		Level:        band.Level,
+		GradeValue:   band.Value,
 		Score:        score,
 		DownloadMbps: downloadMbps,
 		Jitter:       jitter,
 		Latency:      latency,
 		Bufferbloat:  bufferbloat,
 		Details:      details,
+
+		JitterInsufficient: insufficient,
+		Components:         components,
 	}
 }
 
+// String is the one-line summary of the grade and the figures behind it,
+// leaving out those the run did not measure.
 func (h *HealthScore) String() string {
-	return fmt.Sprintf("Grade: %s (%d/100) | Download: %.2f Mbps | Latency: %v | Jitter: %v | Bufferbloat: %s",
-		h.Grade, h.Score, h.DownloadMbps, h.Latency, h.Jitter, h.Bufferbloat)
+	parts := []string{fmt.Sprintf("Grade: %s (%d/100)", h.Grade, h.Score)}
+	if h.measured(DetractorBandwidth) {
+		parts = append(parts, fmt.Sprintf("Download: %.2f Mbps", h.DownloadMbps))
+	}
+	if h.measured(DetractorLatency) {
+		parts = append(parts, "Latency: "+FormatDuration(h.Latency))
+	}
+	if h.measured(DetractorJitter) {
+		jitter := FormatDuration(h.Jitter)
+		if h.JitterInsufficient {
+			jitter = "n/a"
+		}
+		parts = append(parts, "Jitter: "+jitter)
+	}
+	if h.measured(DetractorBufferbloat) {
+		parts = append(parts, "Bufferbloat: "+h.Bufferbloat)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// measured reports whether the named component was measured. A score
+// built by hand, without components, counts everything as measured.
+func (h *HealthScore) measured(name string) bool {
+	for _, c := range h.Components {
+		if c.Name == name {
+			return c.Measured
+		}
+	}
+	return len(h.Components) == 0
 }
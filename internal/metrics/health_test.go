@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateHealthScoreSkippedPhases(t *testing.T) {
+	smooth := &JitterResult{Jitter: 2 * time.Millisecond, Samples: 10}
+	tests := []struct {
+		name     string
+		mbps     float64
+		jitter   *JitterResult
+		latency  time.Duration
+		bloat    string
+		score    int
+		verdict  string
+		omits    []string
+		mentions []string
+	}{
+		{
+			name: "all measured", mbps: 60, jitter: smooth, latency: 20 * time.Millisecond, bloat: "Low",
+			score: 90, verdict: "Bandwidth", mentions: []string{"Download:", "Latency:", "Jitter:", "Bufferbloat:"},
+		},
+		{
+			name: "latency only", latency: 20 * time.Millisecond, bloat: "Unknown",
+			score: 100, verdict: "Nothing stands out", omits: []string{"Download:", "Jitter:", "Bufferbloat:"},
+		},
+		{
+			name: "slow latency only", latency: 150 * time.Millisecond, bloat: "Unknown",
+			score: 20, verdict: "Latency", omits: []string{"Download:", "Jitter:"},
+		},
+		{
+			name: "no download", jitter: smooth, latency: 20 * time.Millisecond, bloat: "High",
+			score: 71, verdict: "Bufferbloat", omits: []string{"Download:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := CalculateHealthScore(tt.mbps, tt.jitter, tt.latency, tt.bloat, DefaultGradeScale)
+			if h.Score != tt.score {
+				t.Errorf("score = %d, want %d", h.Score, tt.score)
+			}
+			if v := h.Verdict(); !strings.HasPrefix(v, tt.verdict) {
+				t.Errorf("verdict = %q, want it to start with %q", v, tt.verdict)
+			}
+			line := h.String()
+			for _, s := range tt.omits {
+				if strings.Contains(line, s) {
+					t.Errorf("health line %q mentions skipped %q", line, s)
+				}
+			}
+			for _, s := range tt.mentions {
+				if !strings.Contains(line, s) {
+					t.Errorf("health line %q lacks %q", line, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var DefaultHistogramBounds = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// Histogram counts latency samples into buckets delimited by Bounds. A
+// sample falls into the first bucket whose upper bound exceeds it; the
+// final bucket collects everything at or above the last bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int
+}
+
+func NewHistogram(bounds []time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultHistogramBounds
+	}
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]int, len(bounds)+1),
+	}
+}
+
+func ParseHistogramBounds(s string) ([]time.Duration, error) {
+	var bounds []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram bucket %q: %w", part, err)
+		}
+		if len(bounds) > 0 && d <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("histogram buckets must be increasing: %v after %v", d, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, d)
+	}
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("no histogram buckets given")
+	}
+	return bounds, nil
+}
+
+func (h *Histogram) Add(d time.Duration) {
+	for i, b := range h.Bounds {
+		if d < b {
+			h.Counts[i]++
+			return
+		}
+	}
+	h.Counts[len(h.Counts)-1]++
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || len(other.Counts) != len(h.Counts) {
+		return
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+}
+
+func (h *Histogram) Total() int {
+	total := 0
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+func (h *Histogram) Labels() []string {
+	labels := make([]string, len(h.Counts))
+	var lower time.Duration
+	for i, b := range h.Bounds {
+		labels[i] = fmt.Sprintf("%s-%v", trimUnit(lower, b), b)
+		lower = b
+	}
+	labels[len(labels)-1] = fmt.Sprintf("%v+", lower)
+	return labels
+}
+
+func (h *Histogram) Bars(width int) string {
+	labels := h.Labels()
+	labelWidth := 0
+	for _, l := range labels {
+		if len(l) > labelWidth {
+			labelWidth = len(l)
+		}
+	}
+
+	peak := 0
+	for _, c := range h.Counts {
+		if c > peak {
+			peak = c
+		}
+	}
+
+	var sb strings.Builder
+	for i, c := range h.Counts {
+		n := 0
+		if peak > 0 {
+			n = c * width / peak
+		}
+		fmt.Fprintf(&sb, "  %-*s |%-*s| %d\n", labelWidth, labels[i], width, strings.Repeat("#", n), c)
+	}
+	return sb.String()
+}
+
+// trimUnit renders the lower bound without its unit when it matches the
+// upper bound's, so buckets read "10-25ms" rather than "10ms-25ms".
+func trimUnit(lower, upper time.Duration) string {
+	if lower == 0 {
+		return "0"
+	}
+	l, u := lower.String(), upper.String()
+	for _, unit := range []string{"ms", "µs", "ns", "s"} {
+		if strings.HasSuffix(l, unit) && strings.HasSuffix(u, unit) {
+			return strings.TrimSuffix(l, unit)
+		}
+	}
+	return l
+}
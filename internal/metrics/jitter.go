@@ -2,39 +2,99 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
-	"net/http"
+	"net"
 	"sort"
+	"syscall"
 	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
 )
 
 type JitterResult struct {
-	Jitter        time.Duration
-	MinLatency   time.Duration
-	MaxLatency   time.Duration
-	AvgLatency   time.Duration
-	PacketLoss   float64
-	Samples      int
+	Jitter     time.Duration
+	MinLatency time.Duration
+	MaxLatency time.Duration
+	AvgLatency time.Duration
+	PacketLoss float64
+	Samples    int
+	Histogram  *Histogram
+	Raw        []Sample
+
+	// Insufficient is set when fewer than two probes got a response, so no
+	// jitter could be computed. Jitter is then 0 but means unknown, not
+	// perfect.
+	Insufficient bool
+
+	Timeouts    int
+	ConnErrors  int
+	NoResponses int
 }
 
-func MeasureJitter(ctx context.Context, url string, samples int, interval time.Duration) (*JitterResult, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
+// Sample is a single jitter probe in the order it was taken.
+type Sample struct {
+	Seq     int
+	Time    time.Time
+	Latency time.Duration
+	Error   string
+}
+
+// MeasureJitter times samples probes to url, interval apart. Failed probes
+// count as loss. When none got a response, the result comes back with an
+// error for the last failure, so callers can tell why as well as how much.
+func MeasureJitter(ctx context.Context, url string, samples int, interval time.Duration, histogram []time.Duration) (*JitterResult, error) {
+	client := httpclient.New(10 * time.Second)
 	latencies := make([]time.Duration, 0, samples)
+	raw := make([]Sample, 0, samples)
+	var timeouts, connErrors, noResponses int
+	var lastErr error
+	countFailure := func(err error) {
+		switch classifyFailure(err) {
+		case failureTimeout:
+			timeouts++
+		case failureConn:
+			connErrors++
+		default:
+			noResponses++
+		}
+	}
 
 	for i := 0; i < samples; i++ {
+		reqCtx, err := httpclient.Admit(ctx)
+		if err != nil {
+			lastErr = err
+			break
+		}
 		start := time.Now()
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req, err := httpclient.NewProbeRequest(reqCtx, url)
 		if err != nil {
+			raw = append(raw, Sample{Seq: i, Time: start, Error: err.Error()})
+			connErrors++
+			lastErr = err
 			continue
 		}
 
-		_, err = client.Do(req)
+		resp, err := client.Do(req)
 		if err != nil {
+			raw = append(raw, Sample{Seq: i, Time: start, Error: err.Error()})
+			countFailure(err)
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		// A server error is an answer, but not from a working service.
+		if resp.StatusCode >= 500 {
+			raw = append(raw, Sample{Seq: i, Time: start, Error: resp.Status})
+			noResponses++
+			lastErr = fmt.Errorf("server error: %s", resp.Status)
 			continue
 		}
 
 		latency := time.Since(start)
 		latencies = append(latencies, latency)
+		raw = append(raw, Sample{Seq: i, Time: start, Latency: latency})
 
 		if i < samples-1 {
 			select {
@@ -45,12 +105,31 @@ func MeasureJitter(ctx context.Context, url string, samples int, interval time.D
 		}
 	}
 
+	var hist *Histogram
+	if histogram != nil {
+		hist = NewHistogram(histogram)
+		for _, l := range latencies {
+			hist.Add(l)
+		}
+	}
+
 	if len(latencies) < 2 {
+		var err error
+		if len(latencies) == 0 && lastErr != nil {
+			err = wrapError("jitter", lastErr)
+		}
 		return &JitterResult{
-			Jitter:      0,
-			Samples:     len(latencies),
-			PacketLoss:  float64(samples-len(latencies)) / float64(samples) * 100,
-		}, nil
+			Jitter:       0,
+			Insufficient: true,
+			Samples:      len(latencies),
+			PacketLoss:   float64(samples-len(latencies)) / float64(samples) * 100,
+			Histogram:    hist,
+			Raw:          raw,
+
+			Timeouts:    timeouts,
+			ConnErrors:  connErrors,
+			NoResponses: noResponses,
+		}, err
 	}
 
 	sort.Slice(latencies, func(i, j int) bool {
@@ -71,11 +150,42 @@ func MeasureJitter(ctx context.Context, url string, samples int, interval time.D
 	jitter := time.Duration(math.Sqrt(varianceSum / float64(len(latencies)-1)))
 
 	return &JitterResult{
-		Jitter:      jitter,
-		MinLatency:  latencies[0],
-		MaxLatency:  latencies[len(latencies)-1],
-		AvgLatency:  avgLatency,
-		Samples:     len(latencies),
-		PacketLoss:  float64(samples-len(latencies)) / float64(samples) * 100,
+		Jitter:     jitter,
+		MinLatency: latencies[0],
+		MaxLatency: latencies[len(latencies)-1],
+		AvgLatency: avgLatency,
+		Samples:    len(latencies),
+		PacketLoss: float64(samples-len(latencies)) / float64(samples) * 100,
+		Histogram:  hist,
+		Raw:        raw,
+
+		Timeouts:    timeouts,
+		ConnErrors:  connErrors,
+		NoResponses: noResponses,
 	}, nil
 }
+
+const (
+	failureTimeout = "timeout"
+	failureConn    = "conn"
+	failureOther   = "other"
+)
+
+// classifyFailure separates requests that ran out of time (an overloaded
+// server or congested path) from ones whose connection was refused, reset
+// or never resolved (a broken path). Anything else, such as the server
+// closing the connection without answering, is a plain non-response.
+func classifyFailure(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return failureTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return failureConn
+	}
+	return failureOther
+}
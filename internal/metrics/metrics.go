@@ -4,28 +4,67 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"net/http"
 	"net/http/httptrace"
 	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
 )
 
 type LatencyResult struct {
-	TTFB          time.Duration
-	Latency       time.Duration
-	Connected     time.Duration
-	TLSHandshake  time.Duration
-	Error         error
+	TTFB         time.Duration
+	Latency      time.Duration
+	Connected    time.Duration
+	TLSHandshake time.Duration
+	Protocol     string
+	Error        error `json:"-"`
+
+	// ServerTiming holds the metrics the server reported in its
+	// Server-Timing header, if any.
+	ServerTiming []ServerTiming
+
+	// ConnTraced is set when the transport reported the connection the
+	// request went out on; HTTP/3 does not. Reused is then set when it was
+	// a pooled connection, so Latency holds no connection setup, and
+	// WasIdle when that connection had been idle, for IdleTime.
+	ConnTraced bool
+	Reused     bool
+	WasIdle    bool
+	IdleTime   time.Duration
+}
+
+// ConnState describes the connection of the measurement, such as "new
+// connection, includes setup" or "reused connection, idle 2.1s", or is
+// empty when it is unknown. A new connection's latency includes the TCP
+// and TLS setup that later requests over the same connection skip.
+func (r *LatencyResult) ConnState() string {
+	switch {
+	case !r.ConnTraced:
+		return ""
+	case !r.Reused:
+		return "new connection, includes setup"
+	case r.WasIdle:
+		return "reused connection, idle " + FormatDuration(r.IdleTime)
+	default:
+		return "reused connection"
+	}
 }
 
 func MeasureLatency(ctx context.Context, url string) (*LatencyResult, error) {
+	ctx, err := httpclient.Admit(ctx)
+	if err != nil {
+		return nil, wrapError("latency", err)
+	}
 	start := time.Now()
 	var ttfb, connected, tlsHandshake time.Duration
+	var conn httptrace.GotConnInfo
+	var traced bool
 
 	trace := &httptrace.ClientTrace{
 		GotConn: func(info httptrace.GotConnInfo) {
 			connected = time.Since(start)
+			conn, traced = info, true
 		},
-	TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
 			tlsHandshake = time.Since(start)
 		},
 		GotFirstResponseByte: func() {
@@ -33,26 +72,30 @@ func MeasureLatency(ctx context.Context, url string) (*LatencyResult, error) {
 		},
 	}
 
-	req, err := http.NewRequestWithContext(
-		httptrace.WithClientTrace(ctx, trace),
-		"GET", url, nil,
-	)
+	req, err := httpclient.NewProbeRequest(httptrace.WithClientTrace(ctx, trace), url)
 	if err != nil {
 		return nil, err
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := httpclient.New(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, wrapError("latency", err)
 	}
 	defer resp.Body.Close()
 
 	return &LatencyResult{
-		TTFB:          ttfb,
-		Latency:       time.Since(start),
-		Connected:     connected,
-		TLSHandshake:  tlsHandshake,
+		TTFB:         ttfb,
+		Latency:      time.Since(start),
+		Connected:    connected,
+		TLSHandshake: tlsHandshake,
+		Protocol:     resp.Proto,
+		ServerTiming: ParseServerTiming(resp.Header.Values("Server-Timing")),
+
+		ConnTraced: traced,
+		Reused:     conn.Reused,
+		WasIdle:    conn.WasIdle,
+		IdleTime:   conn.IdleTime,
 	}, nil
 }
 
@@ -60,5 +103,5 @@ func FormatLatency(r *LatencyResult) string {
 	if r.Error != nil {
 		return fmt.Sprintf("Error: %v", r.Error)
 	}
-	return fmt.Sprintf("TTFB: %v | Latency: %v", r.TTFB, r.Latency)
+	return fmt.Sprintf("TTFB: %s | Latency: %s", FormatDuration(r.TTFB), FormatDuration(r.Latency))
 }
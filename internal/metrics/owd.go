@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// OneWayResult splits the round trip at the server's own timestamp. Both
+// directions are only as accurate as the clock sync between client and
+// server: a skew of 5ms moves 5ms from one direction to the other. A
+// negative direction means the clocks are clearly out of sync.
+type OneWayResult struct {
+	Upstream    time.Duration
+	Downstream  time.Duration
+	RTT         time.Duration
+	Samples     int
+	SkewSuspect bool
+}
+
+// MeasureOneWayDelay takes samples requests to a server that puts its
+// receive time in header, and returns the median delay each way.
+func MeasureOneWayDelay(ctx context.Context, url, header string, samples int) (*OneWayResult, error) {
+	client := httpclient.New(10 * time.Second)
+	var ups, downs, rtts []time.Duration
+	var lastErr error
+
+	for i := 0; i < samples; i++ {
+		var sent, received time.Time
+		trace := &httptrace.ClientTrace{
+			WroteRequest:         func(httptrace.WroteRequestInfo) { sent = time.Now() },
+			GotFirstResponseByte: func() { received = time.Now() },
+		}
+		req, err := httpclient.NewRequest(httptrace.WithClientTrace(ctx, trace), "HEAD", url)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		value := resp.Header.Get(header)
+		if value == "" {
+			return nil, fmt.Errorf("server did not send the %s header", header)
+		}
+		serverTime, err := parseServerTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s header: %w", header, err)
+		}
+
+		ups = append(ups, serverTime.Sub(sent))
+		downs = append(downs, received.Sub(serverTime))
+		rtts = append(rtts, received.Sub(sent))
+	}
+
+	if len(rtts) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no samples")
+		}
+		return nil, lastErr
+	}
+
+	r := &OneWayResult{
+		Upstream:   Median(ups),
+		Downstream: Median(downs),
+		RTT:        Median(rtts),
+		Samples:    len(rtts),
+	}
+	r.SkewSuspect = r.Upstream < 0 || r.Downstream < 0
+	return r, nil
+}
+
+// parseServerTime accepts a Unix timestamp in seconds (with an optional
+// fraction), milliseconds, microseconds or nanoseconds, or RFC 3339.
+func parseServerTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n > 1e17:
+			return time.Unix(0, n), nil
+		case n > 1e14:
+			return time.UnixMicro(n), nil
+		case n > 1e11:
+			return time.UnixMilli(n), nil
+		default:
+			return time.Unix(n, 0), nil
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(f*1e9)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
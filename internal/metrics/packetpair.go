@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+const (
+	packetPairProbes = 8
+	packetPairBytes  = 64 * 1024
+)
+
+type PacketPairResult struct {
+	Mbps       float64
+	Confidence string
+	Samples    int
+	BytesUsed  int64
+}
+
+// EstimateBandwidthPacketPair infers bottleneck capacity from how far apart
+// the packets of a small back-to-back burst arrive. Each probe asks for a
+// short byte range on a warm connection; the server writes it in one go, so
+// the spread between the first and last chunk is set by the slowest link on
+// the path. The result is approximate: cross traffic, receive coalescing
+// and servers that pace their writes all skew it, which is what the
+// confidence reflects. It transfers well under a megabyte.
+func EstimateBandwidthPacketPair(ctx context.Context, url string) (*PacketPairResult, error) {
+	client := httpclient.New(10 * time.Second)
+	result := &PacketPairResult{}
+
+	// The first request pays for connection setup and slow start, so it
+	// only warms the connection.
+	if _, n, err := packetPairProbe(ctx, client, url); err == nil {
+		result.BytesUsed += n
+	}
+
+	var rates []float64
+	for i := 0; i < packetPairProbes; i++ {
+		rate, n, err := packetPairProbe(ctx, client, url)
+		result.BytesUsed += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if rate > 0 {
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no usable packet-pair samples")
+	}
+
+	sort.Float64s(rates)
+	result.Mbps = rates[len(rates)/2]
+	result.Samples = len(rates)
+	result.Confidence = packetPairConfidence(rates)
+	return result, nil
+}
+
+// packetPairProbe reads one burst and returns the rate implied by the
+// dispersion of everything after the first chunk.
+func packetPairProbe(ctx context.Context, client *http.Client, url string) (float64, int64, error) {
+	req, err := httpclient.NewRequest(ctx, "GET", url)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", packetPairBytes-1))
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	// Servers that ignore Range send the whole file; stop after the burst.
+	body := io.LimitReader(resp.Body, packetPairBytes)
+	buf := make([]byte, 4096)
+
+	var total, afterFirst int64
+	var first, last time.Time
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			now := time.Now()
+			if first.IsZero() {
+				first = now
+			} else {
+				afterFirst += int64(n)
+			}
+			last = now
+			total += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, total, err
+		}
+	}
+
+	dispersion := last.Sub(first)
+	if afterFirst == 0 || dispersion <= 0 {
+		return 0, total, nil
+	}
+	return float64(afterFirst*8) / 1_000_000 / dispersion.Seconds(), total, nil
+}
+
+// packetPairConfidence grades how consistent the samples were, using the
+// spread of the middle half relative to the median.
+func packetPairConfidence(rates []float64) string {
+	if len(rates) < 3 {
+		return "Low"
+	}
+	q1 := rates[len(rates)/4]
+	q3 := rates[(3*len(rates))/4]
+	median := rates[len(rates)/2]
+	spread := math.Abs(q3-q1) / median
+
+	switch {
+	case spread < 0.25:
+		return "High"
+	case spread < 0.6:
+		return "Medium"
+	default:
+		return "Low"
+	}
+}
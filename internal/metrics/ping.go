@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// PingResult summarizes a series of TCP connect round trips to a host.
+// Jitter is the RMS difference between consecutive round trips, as for
+// JitterResult.
+type PingResult struct {
+	Addr     string
+	Sent     int
+	Received int
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	Jitter   time.Duration
+}
+
+// Loss returns the percentage of pings that got no answer.
+func (r *PingResult) Loss() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Sent-r.Received) / float64(r.Sent) * 100
+}
+
+// Ping times count TCP handshakes to the host and port of rawURL,
+// interval apart. A handshake takes one round trip and, unlike ICMP echo,
+// needs no privileges and passes the same firewalls as the test itself.
+func Ping(ctx context.Context, rawURL string, count int, interval, timeout time.Duration) (*PingResult, error) {
+	c, err := ConnectTest(ctx, rawURL, count, interval, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return c.ping(), nil
+}
+
+func (c *ConnectResult) ping() *PingResult {
+	r := &PingResult{
+		Addr:     c.Addr,
+		Sent:     c.Attempts,
+		Received: c.Successes,
+		Min:      c.Min,
+		Max:      c.Max,
+	}
+	if len(c.Times) == 0 {
+		return r
+	}
+	var sum time.Duration
+	var varianceSum float64
+	for i, t := range c.Times {
+		sum += t
+		if i > 0 {
+			diff := float64(t - c.Times[i-1])
+			varianceSum += diff * diff
+		}
+	}
+	r.Avg = sum / time.Duration(len(c.Times))
+	if len(c.Times) > 1 {
+		r.Jitter = time.Duration(math.Sqrt(varianceSum / float64(len(c.Times)-1)))
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	PortOpen     = "open"
+	PortClosed   = "closed"
+	PortFiltered = "filtered"
+)
+
+type PortSpec struct {
+	Host  string
+	Port  int
+	Proto string
+}
+
+type PortResult struct {
+	Host        string
+	Port        int
+	Proto       string
+	State       string
+	ConnectTime time.Duration
+	Error       string
+}
+
+// ParsePortSpecs parses a list such as "443/tcp,example.com:3478/udp".
+// Entries without a host use defaultHost; the protocol defaults to tcp.
+func ParsePortSpecs(s, defaultHost string) ([]PortSpec, error) {
+	var specs []PortSpec
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		proto := "tcp"
+		if p, pr, ok := strings.Cut(part, "/"); ok {
+			part, proto = p, strings.ToLower(pr)
+		}
+		if proto != "tcp" && proto != "udp" {
+			return nil, fmt.Errorf("invalid protocol %q in port list", proto)
+		}
+
+		host := defaultHost
+		portStr := part
+		if h, p, err := net.SplitHostPort(part); err == nil {
+			host, portStr = h, p
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", portStr)
+		}
+		specs = append(specs, PortSpec{Host: host, Port: port, Proto: proto})
+	}
+	return specs, nil
+}
+
+// CheckPort reports whether host:port accepts connections. TCP ports are
+// open when the handshake completes and closed when it is refused. UDP is
+// connectionless, so a port is only known to be open if it answers the
+// probe and closed if an ICMP port-unreachable comes back; silence within
+// the timeout is reported as filtered, which may also mean open.
+func CheckPort(ctx context.Context, host string, port int, proto string, timeout time.Duration) *PortResult {
+	result := &PortResult{Host: host, Port: port, Proto: proto}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, proto, addr)
+	if err != nil {
+		result.State = dialState(err)
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+
+	if proto == "tcp" {
+		result.ConnectTime = time.Since(start)
+		result.State = PortOpen
+		return result
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write([]byte("pulsego\n")); err != nil {
+		result.State = dialState(err)
+		result.Error = err.Error()
+		return result
+	}
+
+	buf := make([]byte, 512)
+	if _, err := conn.Read(buf); err != nil {
+		result.State = dialState(err)
+		if result.State != PortFiltered {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	result.ConnectTime = time.Since(start)
+	result.State = PortOpen
+	return result
+}
+
+func dialState(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return PortClosed
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return PortFiltered
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return PortFiltered
+	}
+	return PortClosed
+}
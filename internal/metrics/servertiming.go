@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerTiming is one metric from a Server-Timing response header, as
+// CDNs use to break down edge and origin processing time.
+type ServerTiming struct {
+	Name        string
+	Duration    time.Duration
+	Description string
+}
+
+// ParseServerTiming parses Server-Timing header values such as
+// `cdn-cache;desc=HIT, origin;dur=12.5`. Durations are in milliseconds.
+// Entries without a valid name are skipped and unparsable parameters are
+// ignored, so a malformed header yields whatever could be read.
+func ParseServerTiming(values []string) []ServerTiming {
+	var timings []ServerTiming
+	for _, v := range values {
+		for _, entry := range splitQuoted(v, ',') {
+			params := splitQuoted(entry, ';')
+			name := strings.TrimSpace(params[0])
+			if !isToken(name) {
+				continue
+			}
+
+			st := ServerTiming{Name: name}
+			for _, p := range params[1:] {
+				key, val, ok := strings.Cut(p, "=")
+				if !ok {
+					continue
+				}
+				val = strings.TrimSpace(val)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "dur":
+					ms, err := strconv.ParseFloat(val, 64)
+					if err == nil && ms >= 0 {
+						st.Duration = time.Duration(ms * float64(time.Millisecond))
+					}
+				case "desc":
+					if uq, err := strconv.Unquote(val); err == nil {
+						val = uq
+					}
+					st.Description = val
+				}
+			}
+			timings = append(timings, st)
+		}
+	}
+	return timings
+}
+
+// splitQuoted splits s at sep, except inside double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
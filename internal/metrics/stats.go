@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+func Median(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// MedianSampleLatency returns the median latency of the samples that got
+// a response, or 0 if none did.
+func MedianSampleLatency(samples []Sample) time.Duration {
+	var latencies []time.Duration
+	for _, s := range samples {
+		if s.Error == "" {
+			latencies = append(latencies, s.Latency)
+		}
+	}
+	return Median(latencies)
+}
+
+// CoefficientOfVariation is the sample standard deviation of values as a
+// fraction of their mean, so runs of a fast and a slow link compare on the
+// same scale. It is 0 for fewer than two values or a zero mean.
+func CoefficientOfVariation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq/float64(len(values)-1)) / math.Abs(mean)
+}
+
+// Repeatability labels a coefficient of variation: "high" below 5%,
+// "medium" below 15% and "low" above.
+func Repeatability(cv float64) string {
+	switch {
+	case cv < 0.05:
+		return "high"
+	case cv < 0.15:
+		return "medium"
+	default:
+		return "low"
+	}
+}
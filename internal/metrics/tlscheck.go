@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// TLSPolicy is what -strict-tls holds a server to.
+type TLSPolicy struct {
+	// MinVersion is the lowest acceptable protocol version, e.g.
+	// tls.VersionTLS12.
+	MinVersion uint16
+
+	// ExpiryWarning flags a certificate that expires within this long.
+	ExpiryWarning time.Duration
+}
+
+// TLSResult is what a server negotiated and how it measures up to a
+// TLSPolicy. Violations is empty when the server passes.
+type TLSResult struct {
+	Version  string
+	Cipher   string
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+
+	Violations []string
+}
+
+// ParseTLSVersion accepts 1.0, 1.1, 1.2 or 1.3.
+func ParseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.TrimSpace(s), "TLS") {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", s)
+}
+
+// CheckTLS handshakes with the server of an https URL on a connection of
+// its own and applies policy. The handshake offers every protocol version
+// and cipher suite Go implements, insecure ones included, so the result
+// shows what the server is willing to negotiate rather than what a strict
+// client would settle for. The chain is verified separately so that an
+// invalid certificate is reported as a violation with the other details,
+// not as a failed handshake.
+func CheckTLS(ctx context.Context, rawURL string, policy TLSPolicy, timeout time.Duration) (*TLSResult, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if u.Scheme != "https" {
+		return &TLSResult{Violations: []string{"the connection is not encrypted (plain http)"}}, nil
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var suites []uint16
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites = append(suites, s.ID)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS10,
+		CipherSuites:       suites,
+		InsecureSkipVerify: true,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+
+	r := &TLSResult{
+		Version: tls.VersionName(state.Version),
+		Cipher:  tls.CipherSuiteName(state.CipherSuite),
+	}
+	if state.Version < policy.MinVersion {
+		r.Violations = append(r.Violations, fmt.Sprintf("protocol %s is below the minimum %s",
+			r.Version, tls.VersionName(policy.MinVersion)))
+	}
+	if weakCipher(state.CipherSuite) {
+		r.Violations = append(r.Violations, "weak cipher suite "+r.Cipher)
+	}
+
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		r.Violations = append(r.Violations, "the server presented no certificate")
+		return r, nil
+	}
+	leaf := certs[0]
+	r.Subject = leaf.Subject.CommonName
+	if r.Subject == "" && len(leaf.DNSNames) > 0 {
+		r.Subject = leaf.DNSNames[0]
+	}
+	r.Issuer = leaf.Issuer.CommonName
+	if r.Issuer == "" {
+		r.Issuer = leaf.Issuer.String()
+	}
+
+	// The chain is only as good as its earliest expiry.
+	r.NotAfter = leaf.NotAfter
+	for _, c := range certs[1:] {
+		if c.NotAfter.Before(r.NotAfter) {
+			r.NotAfter = c.NotAfter
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, verifyErr := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	left := time.Until(r.NotAfter)
+	switch {
+	case left <= 0:
+		r.Violations = append(r.Violations, fmt.Sprintf("certificate expired on %s", r.NotAfter.Format("2006-01-02")))
+	case verifyErr != nil:
+		r.Violations = append(r.Violations, "invalid certificate chain: "+verifyErr.Error())
+	}
+	if left > 0 && left < policy.ExpiryWarning {
+		r.Violations = append(r.Violations, fmt.Sprintf("certificate expires in %d days, on %s",
+			int(left.Hours()/24), r.NotAfter.Format("2006-01-02")))
+	}
+	return r, nil
+}
+
+// weakCipher reports whether id is one of Go's insecure suites or lacks
+// forward secrecy (plain RSA key exchange) or authenticated encryption.
+func weakCipher(id uint16) bool {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.ID == id {
+			return true
+		}
+	}
+	name := tls.CipherSuiteName(id)
+	return strings.HasPrefix(name, "TLS_RSA_") || strings.Contains(name, "_CBC_")
+}
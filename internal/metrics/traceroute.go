@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"time"
+)
+
+// tracePort is the first destination port of traceroute probes, as used
+// by the classic Unix traceroute; each hop adds one so replies can be told
+// apart.
+const tracePort = 33434
+
+// Hop is one TTL of a traceroute. Addr is the router that answered, or
+// empty when none did within the timeout.
+type Hop struct {
+	TTL  int
+	Addr string
+	RTT  time.Duration
+}
+
+// TracerouteResult lists the hops towards Target. Reached is set when the
+// target itself answered, so the list is complete.
+type TracerouteResult struct {
+	Target  string
+	Hops    []Hop
+	Reached bool
+}
+
+// Traceroute sends one UDP probe per TTL, up to maxHops, towards the host
+// of rawURL and records which router reports the probe expired. It stops
+// at the first hop where the host itself answers. Only IPv4 is traced.
+func Traceroute(ctx context.Context, rawURL string, maxHops int, timeout time.Duration) (*TracerouteResult, error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", u.Hostname())
+	if err != nil {
+		return nil, wrapError("traceroute", err)
+	}
+
+	r := &TracerouteResult{Target: ips[0].String()}
+	for ttl := 1; ttl <= maxHops && ctx.Err() == nil; ttl++ {
+		hop, reached, err := traceHop(ctx, ips[0].To4(), ttl, timeout)
+		if err != nil {
+			return r, fmt.Errorf("traceroute: %w", err)
+		}
+		r.Hops = append(r.Hops, hop)
+		if reached {
+			r.Reached = true
+			break
+		}
+	}
+	return r, nil
+}
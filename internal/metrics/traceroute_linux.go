@@ -0,0 +1,95 @@
+//go:build linux
+
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// soEEOriginICMP is SO_EE_ORIGIN_ICMP: the queued error came from an ICMP
+// message rather than the local stack.
+const soEEOriginICMP = 2
+
+// traceHop sends a UDP probe to dst with the given TTL and waits for the
+// ICMP error it provokes. IP_RECVERR queues that error on the socket
+// together with the router that sent it, so no raw socket, and no
+// privilege, is needed. reached is set when dst itself answered with port
+// unreachable.
+func traceHop(ctx context.Context, dst net.IP, ttl int, timeout time.Duration) (hop Hop, reached bool, err error) {
+	hop.TTL = ttl
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return hop, false, err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, ttl); err != nil {
+		return hop, false, err
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_RECVERR, 1); err != nil {
+		return hop, false, err
+	}
+
+	sa := &syscall.SockaddrInet4{Port: tracePort + ttl}
+	copy(sa.Addr[:], dst)
+	start := time.Now()
+	if err := syscall.Sendto(fd, []byte("pulsego"), 0, sa); err != nil {
+		return hop, false, err
+	}
+
+	buf := make([]byte, 512)
+	oob := make([]byte, 512)
+	deadline := start.Add(timeout)
+	for time.Now().Before(deadline) {
+		_, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+		if errors.Is(err, syscall.EAGAIN) {
+			select {
+			case <-ctx.Done():
+				return hop, false, nil
+			case <-time.After(5 * time.Millisecond):
+			}
+			continue
+		}
+		if err != nil {
+			return hop, false, err
+		}
+		hop.RTT = time.Since(start)
+		from, icmpType, ok := parseRecvErr(oob[:oobn])
+		if !ok {
+			continue
+		}
+		hop.Addr = from.String()
+		// Type 3 is destination unreachable; anything else that comes
+		// back, in practice time exceeded (11), is from a router on the way.
+		return hop, icmpType == 3 && from.Equal(dst), nil
+	}
+	return hop, false, nil
+}
+
+// parseRecvErr extracts the sender and ICMP type from an IP_RECVERR control
+// message: a struct sock_extended_err followed by the offender's
+// sockaddr_in.
+func parseRecvErr(oob []byte) (net.IP, uint8, bool) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, 0, false
+	}
+	for _, m := range msgs {
+		if m.Header.Level != syscall.IPPROTO_IP || m.Header.Type != syscall.IP_RECVERR || len(m.Data) < 16+8 {
+			continue
+		}
+		if m.Data[4] != soEEOriginICMP {
+			continue
+		}
+		offender := m.Data[16:]
+		if binary.NativeEndian.Uint16(offender) != syscall.AF_INET {
+			continue
+		}
+		return net.IPv4(offender[4], offender[5], offender[6], offender[7]), m.Data[5], true
+	}
+	return nil, 0, false
+}
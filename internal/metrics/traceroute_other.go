@@ -0,0 +1,16 @@
+//go:build !linux
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// traceHop needs IP_RECVERR to read ICMP errors without a raw socket,
+// which only Linux has.
+func traceHop(ctx context.Context, dst net.IP, ttl int, timeout time.Duration) (Hop, bool, error) {
+	return Hop{}, false, errors.New("not supported on this platform")
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/httpclient"
+)
+
+// UploadResult is the throughput of a timed upload. Bytes counts what was
+// handed to the connections, so the first few socket buffers' worth may
+// not have left the host yet when the run ends.
+type UploadResult struct {
+	Mbps     float64
+	Bytes    int64
+	Duration time.Duration
+	Streams  int
+}
+
+// MeasureUpload posts zero-filled bodies to url on streams parallel
+// connections for d and returns the combined rate. The response status is
+// not checked; an endpoint that rejects uploads without reading the body
+// shows up as a near-zero rate.
+func MeasureUpload(ctx context.Context, url string, streams int, d time.Duration) (*UploadResult, error) {
+	client := httpclient.New(0)
+	loadCtx, stop := context.WithTimeout(ctx, d)
+	defer stop()
+
+	var sent atomic.Int64
+	var wg sync.WaitGroup
+	started := make(chan struct{}, streams)
+	start := time.Now()
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uploadLoad(loadCtx, client, url, started, func(n int) { sent.Add(int64(n)) })
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if sent.Load() == 0 {
+		return nil, fmt.Errorf("no data was uploaded; the server may not accept POST requests")
+	}
+	return &UploadResult{
+		Mbps:     float64(sent.Load()*8) / 1_000_000 / max(elapsed, time.Millisecond).Seconds(),
+		Bytes:    sent.Load(),
+		Duration: elapsed,
+		Streams:  streams,
+	}, nil
+}
+
+// Asymmetry is the download:upload ratio, or 0 when either is unknown.
+func Asymmetry(downMbps, upMbps float64) float64 {
+	if downMbps <= 0 || upMbps <= 0 {
+		return 0
+	}
+	return downMbps / upMbps
+}
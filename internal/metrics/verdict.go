@@ -0,0 +1,52 @@
+package metrics
+
+import "fmt"
+
+// Score components a Verdict can blame.
+const (
+	DetractorBandwidth   = "bandwidth"
+	DetractorLatency     = "latency"
+	DetractorJitter      = "jitter"
+	DetractorBufferbloat = "bufferbloat"
+)
+
+// Detractor names the measured component that cost the most points, or
+// returns "" when none lost any. Ties go to the component listed first in
+// the score: bandwidth, latency, jitter, bufferbloat.
+func (h *HealthScore) Detractor() string {
+	var worst string
+	var most int
+	for _, c := range h.Components {
+		if lost := c.Max - c.Points; c.Measured && lost > most {
+			worst, most = c.Name, lost
+		}
+	}
+	return worst
+}
+
+// Verdict is a plain-English summary of what limits the connection most
+// and what to try about it.
+func (h *HealthScore) Verdict() string {
+	switch h.Detractor() {
+	case DetractorBandwidth:
+		return fmt.Sprintf("Bandwidth is what limits you: %.0f Mbps is slow for HD streaming and large downloads. "+
+			"Test over Ethernet to rule out Wi-Fi, and if it stays below your plan's speed, contact your ISP.", h.DownloadMbps)
+	case DetractorLatency:
+		return fmt.Sprintf("Latency is what limits you: %s per round trip makes games and calls feel sluggish. "+
+			"Use a wired connection or a closer server, and ask your ISP about routing if it persists.", FormatDuration(h.Latency))
+	case DetractorJitter:
+		if h.JitterInsufficient {
+			return "Your connection is dropping requests, so latency could not even be measured reliably. " +
+				"Check the cabling or Wi-Fi signal, restart the router, and contact your ISP if it continues."
+		}
+		return fmt.Sprintf("Unstable latency is what limits you: %s of jitter makes calls and games stutter. "+
+			"Move closer to the Wi-Fi access point or use Ethernet, and pause other heavy traffic.", FormatDuration(h.Jitter))
+	case DetractorBufferbloat:
+		advice := "Enable SQM (fq_codel or cake) on your router, set a little below your line speed."
+		if h.DownloadMbps >= 100 {
+			return "Your bandwidth is good but high bufferbloat will hurt video calls whenever the link is busy. " + advice
+		}
+		return "Bufferbloat is what limits you: latency climbs whenever the link is busy, which hurts video calls and games. " + advice
+	}
+	return "Nothing stands out: this connection is fine for streaming, gaming and video calls."
+}
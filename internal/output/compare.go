@@ -0,0 +1,136 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+type comparison struct {
+	name         string
+	unit         string
+	before       float64
+	after        float64
+	higherBetter bool
+}
+
+func LoadJSON(path string) (*JSONOutput, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out JSONOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &out, nil
+}
+
+func FormatComparison(a, b *JSONOutput) string {
+	// A result measured without a phase compares as zero for it.
+	da, db := a.Download, b.Download
+	if da == nil {
+		da = &Download{}
+	}
+	if db == nil {
+		db = &Download{}
+	}
+	ja, jb := a.Jitter, b.Jitter
+	if ja == nil {
+		ja = &Jitter{}
+	}
+	if jb == nil {
+		jb = &Jitter{}
+	}
+	la, lb := a.Latency, b.Latency
+	if la == nil {
+		la = &Latency{}
+	}
+	if lb == nil {
+		lb = &Latency{}
+	}
+	ba, bb := a.Bufferbloat, b.Bufferbloat
+	if ba == nil {
+		ba = &Bufferbloat{}
+	}
+	if bb == nil {
+		bb = &Bufferbloat{}
+	}
+
+	rows := []comparison{
+		{"Download", "Mbps", da.SpeedMbps, db.SpeedMbps, true},
+		{"Latency", "ms", durationMs(la.Total), durationMs(lb.Total), false},
+		{"TTFB", "ms", durationMs(la.TTFB), durationMs(lb.TTFB), false},
+		{"Jitter", "ms", durationMs(ja.Value), durationMs(jb.Value), false},
+		{"Packet Loss", "%", ja.PacketLoss, jb.PacketLoss, false},
+		{"Bufferbloat", "ms", durationMs(ba.Delta), durationMs(bb.Delta), false},
+		{"Stalls", "", float64(da.StallCount), float64(db.StallCount), false},
+		{"Health Score", "", float64(a.Health.Score), float64(b.Health.Score), true},
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Before: %s | After: %s\n\n",
+		a.Timestamp.Format(time.RFC3339), b.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "%-14s %12s %12s %12s %9s\n", "Metric", "Before", "After", "Delta", "Change")
+
+	regressions := 0
+	for _, row := range rows {
+		delta := row.after - row.before
+		arrow := "="
+		if delta > 0 {
+			arrow = "↑"
+		} else if delta < 0 {
+			arrow = "↓"
+		}
+
+		change := "--"
+		if row.before != 0 {
+			change = fmt.Sprintf("%+.1f%%", delta/row.before*100)
+		}
+
+		color := ""
+		regressed := (row.higherBetter && delta < 0) || (!row.higherBetter && delta > 0)
+		if regressed {
+			color = "\033[31m"
+			regressions++
+		} else if delta != 0 {
+			color = "\033[32m"
+		}
+
+		fmt.Fprintf(&sb, "%s%-14s %12s %12s %10s %s %9s\033[0m\n",
+			color,
+			row.name,
+			formatValue(row.before, row.unit),
+			formatValue(row.after, row.unit),
+			formatValue(math.Abs(delta), row.unit),
+			arrow,
+			change,
+		)
+	}
+
+	fmt.Fprintf(&sb, "\nGrade: %s -> %s", a.Health.Grade, b.Health.Grade)
+	if regressions > 0 {
+		fmt.Fprintf(&sb, " | Regressions: %d", regressions)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func durationMs(s string) float64 {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatValue(v float64, unit string) string {
+	if unit == "" {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f %s", v, unit)
+}
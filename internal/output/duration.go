@@ -0,0 +1,21 @@
+package output
+
+import "time"
+
+// RoundDuration rounds d for display to the millisecond, or to the
+// microsecond below a millisecond so results on fast local links do not
+// collapse to 0s. JSON output uses it so durations stay parseable.
+func RoundDuration(d time.Duration) time.Duration {
+	if d > -time.Millisecond && d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// perSecond is the rate of n events over d, or 0 for an empty interval.
+func perSecond(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
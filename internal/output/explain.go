@@ -0,0 +1,60 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// Component is one line of the -explain score breakdown in JSON.
+type Component struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Bucket   string `json:"bucket"`
+	Points   int    `json:"points"`
+	Max      int    `json:"max"`
+	Measured bool   `json:"measured"`
+}
+
+func components(h *metrics.HealthScore) []Component {
+	out := make([]Component, len(h.Components))
+	for i, c := range h.Components {
+		out[i] = Component(c)
+	}
+	return out
+}
+
+// writeExplain shows how the health score adds up: each component's value,
+// the bucket it fell into and its points, with the running total, and the
+// grade band the total lands in. Components the run skipped are listed
+// without points.
+func writeExplain(sb *strings.Builder, r *Report) {
+	h := r.Health
+	sb.WriteString("\nScore breakdown:\n")
+	total, available := 0, 0
+	for _, c := range h.Components {
+		if !c.Measured {
+			fmt.Fprintf(sb, "  %-12s %s\n", strings.ToUpper(c.Name[:1])+c.Name[1:], c.Value)
+			continue
+		}
+		total += c.Points
+		available += c.Max
+		fmt.Fprintf(sb, "  %-12s %-14s %-24s %3d/%-3d total %3d\n",
+			strings.ToUpper(c.Name[:1])+c.Name[1:], c.Value, c.Bucket, c.Points, c.Max, total)
+	}
+	if available > 0 && available < 100 {
+		fmt.Fprintf(sb, "  %d of the %d points measured scales to %d/100\n", total, available, h.Score)
+	}
+
+	var bands []string
+	for _, b := range r.Scale.Bands {
+		bands = append(bands, fmt.Sprintf("%s >= %d", b.Grade, b.MinScore))
+	}
+	if len(bands) == 0 {
+		for _, b := range metrics.DefaultGradeScale.Bands {
+			bands = append(bands, fmt.Sprintf("%s >= %d", b.Grade, b.MinScore))
+		}
+	}
+	fmt.Fprintf(sb, "  %d/100 is grade %s (%s)\n", h.Score, h.Grade, strings.Join(bands, ", "))
+}
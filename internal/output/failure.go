@@ -0,0 +1,153 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+type FailureJSON struct {
+	Schema      int               `json:"schema_version"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error"`
+	Diagnostics DiagnosticsJSON   `json:"diagnostics"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type DiagnosticsJSON struct {
+	Host       string  `json:"host"`
+	Addr       string  `json:"addr,omitempty"`
+	FailedAt   string  `json:"failed_at,omitempty"`
+	DNSMs      float64 `json:"dns_ms,omitempty"`
+	ConnectMs  float64 `json:"connect_ms,omitempty"`
+	TLSMs      float64 `json:"tls_ms,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+
+	// Resolver is the fallback resolver that answered for Host.
+	Resolver string `json:"resolver,omitempty"`
+}
+
+// FormatFailure renders a run whose download failed entirely, along with
+// whatever the connection diagnostics managed to establish.
+func FormatFailure(err error, d *metrics.Diagnostics, format string, tags map[string]string) string {
+	switch format {
+	case "json":
+		return formatFailureJSON(err, d, tags) + "\n"
+	case "prometheus":
+		return formatFailurePrometheus(d, tags)
+	default:
+		return formatFailureText(err, d)
+	}
+}
+
+func formatFailureText(err error, d *metrics.Diagnostics) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Test FAILED: %v\n\nDiagnostics for %s:\n", err, d.Host)
+
+	step := func(name, stage string, took time.Duration) bool {
+		if d.Stage == stage {
+			fmt.Fprintf(&sb, "  %-12s FAILED (%s)\n", name, d.Error)
+			return false
+		}
+		fmt.Fprintf(&sb, "  %-12s ok %v\n", name, metrics.FormatDuration(took))
+		return true
+	}
+
+	if !step("DNS", metrics.StageDNS, d.DNS) {
+		return sb.String()
+	}
+	if d.Resolver != "" {
+		fmt.Fprintf(&sb, "  %-12s system resolver failed, answered by %s\n", "", d.Resolver)
+	}
+	if !step("TCP connect", metrics.StageConnect, d.Connect) {
+		return sb.String()
+	}
+	if d.TLS > 0 || d.Stage == metrics.StageTLS {
+		if !step("TLS", metrics.StageTLS, d.TLS) {
+			return sb.String()
+		}
+	}
+	if d.Stage == metrics.StageHTTP {
+		fmt.Fprintf(&sb, "  %-12s FAILED (%s)\n", "HTTP", d.Error)
+	} else {
+		fmt.Fprintf(&sb, "  %-12s ok %d\n", "HTTP", d.StatusCode)
+		sb.WriteString("\nThe server is reachable now; the failure happened during the transfer itself.\n")
+	}
+	return sb.String()
+}
+
+func formatFailureJSON(err error, d *metrics.Diagnostics, tags map[string]string) string {
+	out := FailureJSON{
+		Schema:      SchemaVersion,
+		Timestamp:   time.Now(),
+		Status:      "failed",
+		Error:       err.Error(),
+		Diagnostics: diagnosticsJSON(d),
+		Tags:        tags,
+	}
+
+	data, _ := json.MarshalIndent(out, "", "  ")
+	return string(data)
+}
+
+// FormatDiagnosticsJSON renders a connection trace on its own, for runs
+// that did not fail.
+func FormatDiagnosticsJSON(d *metrics.Diagnostics) string {
+	data, _ := json.MarshalIndent(diagnosticsJSON(d), "", "  ")
+	return string(data)
+}
+
+// FormatTracerouteJSON renders a traceroute on its own, as in the
+// traceroute object of the full result.
+func FormatTracerouteJSON(t *metrics.TracerouteResult) string {
+	data, _ := json.MarshalIndent(tracerouteJSON(t), "", "  ")
+	return string(data)
+}
+
+func tracerouteJSON(t *metrics.TracerouteResult) *Traceroute {
+	out := &Traceroute{Target: t.Target, Reached: t.Reached, Hops: []Hop{}}
+	for _, h := range t.Hops {
+		out.Hops = append(out.Hops, Hop{TTL: h.TTL, Addr: h.Addr, RTTMs: ms(h.RTT)})
+	}
+	return out
+}
+
+func diagnosticsJSON(d *metrics.Diagnostics) DiagnosticsJSON {
+	out := DiagnosticsJSON{
+		Host:       d.Host,
+		Addr:       d.Addr,
+		DNSMs:      float64(d.DNS) / float64(time.Millisecond),
+		ConnectMs:  float64(d.Connect) / float64(time.Millisecond),
+		TLSMs:      float64(d.TLS) / float64(time.Millisecond),
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Resolver:   d.Resolver,
+	}
+	if d.Stage != metrics.StageOK {
+		out.FailedAt = d.Stage
+	}
+	return out
+}
+
+func formatFailurePrometheus(d *metrics.Diagnostics, tags map[string]string) string {
+	p := newPromWriter(tags)
+	p.gauge("pulsego_up", "Whether the last test completed (1) or failed (0)", "0")
+	if d.DNS > 0 {
+		p.gauge("pulsego_dns_lookup", "DNS lookup time in milliseconds",
+			fmt.Sprintf("%.2f", float64(d.DNS)/float64(time.Millisecond)))
+	}
+	if d.Connect > 0 {
+		p.gauge("pulsego_tcp_connect", "TCP connect time in milliseconds",
+			fmt.Sprintf("%.2f", float64(d.Connect)/float64(time.Millisecond)))
+	}
+	if d.TLS > 0 {
+		p.gauge("pulsego_tls_handshake", "TLS handshake time in milliseconds",
+			fmt.Sprintf("%.2f", float64(d.TLS)/float64(time.Millisecond)))
+	}
+	return p.sb.String()
+}
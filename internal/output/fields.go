@@ -0,0 +1,242 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+type field struct {
+	name  string
+	value func(r *Report) interface{}
+}
+
+var fields = []field{
+	{"timestamp", func(r *Report) interface{} { return time.Now().Format(time.RFC3339) }},
+	{"download_mbps", downloadField(func(r *Report) interface{} { return r.mbps(r.Download.DownloadSpeed) })},
+	{"upload_mbps", func(r *Report) interface{} {
+		if r.Upload == nil {
+			return nil
+		}
+		return r.mbps(r.Upload.Mbps)
+	}},
+	{"asymmetry_ratio", func(r *Report) interface{} {
+		if r.Asymmetry == 0 {
+			return nil
+		}
+		return math.Round(r.Asymmetry*10) / 10
+	}},
+	{"bytes", downloadField(func(r *Report) interface{} { return r.Download.BytesReceived })},
+	{"bytes_decompressed", downloadField(func(r *Report) interface{} { return r.Download.DecompressedBytes })},
+	{"duration_ms", downloadField(func(r *Report) interface{} { return ms(r.Download.Duration) })},
+	{"connections", downloadField(func(r *Report) interface{} { return r.Download.Connections })},
+	{"errors", downloadField(func(r *Report) interface{} { return r.Download.Errors })},
+	{"error_rate", downloadField(func(r *Report) interface{} { return r.Download.ErrorRate })},
+	{"ttlb_ms", downloadField(func(r *Report) interface{} { return ms(r.Download.TimeToLastByte) })},
+	{"stalls", downloadField(func(r *Report) interface{} { return r.Download.StallCount })},
+	{"longest_stall_ms", downloadField(func(r *Report) interface{} { return ms(r.Download.LongestStall) })},
+	{"ramp_ms", downloadField(func(r *Report) interface{} { return ms(r.Download.RampTime) })},
+	{"fairness_index", func(r *Report) interface{} {
+		index, ok := r.fairness()
+		if !ok {
+			return nil
+		}
+		return math.Round(index*1000) / 1000
+	}},
+	{"latency_ms", func(r *Report) interface{} {
+		if r.Latency == nil {
+			return nil
+		}
+		return ms(r.Latency.Latency)
+	}},
+	{"ttfb_ms", func(r *Report) interface{} {
+		if r.Latency == nil {
+			return nil
+		}
+		return ms(r.Latency.TTFB)
+	}},
+	{"loaded_latency_ms", func(r *Report) interface{} {
+		if r.Download == nil || r.Download.LoadedLatency == 0 {
+			return nil
+		}
+		return ms(r.Download.LoadedLatency)
+	}},
+	{"owd_up_ms", func(r *Report) interface{} {
+		if r.OneWay == nil {
+			return nil
+		}
+		return ms(r.OneWay.Upstream)
+	}},
+	{"owd_down_ms", func(r *Report) interface{} {
+		if r.OneWay == nil {
+			return nil
+		}
+		return ms(r.OneWay.Downstream)
+	}},
+	{"jitter_ms", func(r *Report) interface{} {
+		if r.Jitter == nil || r.Jitter.Insufficient {
+			return nil
+		}
+		return ms(r.Jitter.Jitter)
+	}},
+	{"packet_loss", func(r *Report) interface{} {
+		if r.Jitter == nil {
+			return nil
+		}
+		return r.Jitter.PacketLoss
+	}},
+	{"bufferbloat", func(r *Report) interface{} {
+		if r.Bufferbloat == nil {
+			return nil
+		}
+		return r.Bufferbloat.Severity
+	}},
+	{"bufferbloat_delta_ms", func(r *Report) interface{} {
+		if r.Bufferbloat == nil {
+			return nil
+		}
+		return ms(r.Bufferbloat.BloatDelta)
+	}},
+	{"rpm", func(r *Report) interface{} {
+		if r.Bufferbloat == nil {
+			return nil
+		}
+		return math.Round(r.Bufferbloat.RPM)
+	}},
+	{"grade", func(r *Report) interface{} { return r.Health.Grade }},
+	{"score", func(r *Report) interface{} { return r.Health.Score }},
+	{"level", func(r *Report) interface{} { return r.Health.Level }},
+	{"verdict", func(r *Report) interface{} { return r.Health.Verdict() }},
+}
+
+func FieldNames() []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func ParseFields(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if lookupField(name) == nil {
+			return nil, fmt.Errorf("unknown field %q (valid fields: %s)", name, strings.Join(FieldNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func lookupField(name string) *field {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func (r *Report) selectedFields() []string {
+	if len(r.Fields) > 0 {
+		return r.Fields
+	}
+	return FieldNames()
+}
+
+// formatFieldsJSON renders the selected fields as a flat object, keeping
+// the order in which they were requested.
+func formatFieldsJSON(r *Report) string {
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	names := r.selectedFields()
+	for i, name := range names {
+		key, _ := json.Marshal(name)
+		value, _ := json.Marshal(lookupField(name).value(r))
+		fmt.Fprintf(&buf, "  %s: %s", key, value)
+		if i < len(names)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+func FormatCSV(r *Report) string {
+	names := r.selectedFields()
+	row := make([]string, len(names))
+	for i, name := range names {
+		row[i] = csvValue(lookupField(name).value(r))
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(names)
+	w.Write(row)
+	w.Flush()
+	return buf.String()
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// downloadField wraps the value of a download field so it is null when the
+// download phase did not run.
+func downloadField(value func(r *Report) interface{}) func(r *Report) interface{} {
+	return func(r *Report) interface{} {
+		if r.Download == nil {
+			return nil
+		}
+		return value(r)
+	}
+}
+
+// mbps rounds a speed to the requested precision; a negative precision
+// leaves the value untouched.
+func (r *Report) mbps(v float64) float64 {
+	if r.Precision < 0 {
+		return v
+	}
+	p := math.Pow(10, float64(r.Precision))
+	return math.Round(v*p) / p
+}
+
+// fairness returns Jain's fairness index of the per-connection download
+// speeds, when there were at least two connections to compare.
+func (r *Report) fairness() (float64, bool) {
+	if r.Download == nil || len(r.Download.ConnectionSpeeds) < 2 {
+		return 0, false
+	}
+	return metrics.JainIndex(r.Download.ConnectionSpeeds), true
+}
+
+func (r *Report) mbpsFormat() string {
+	if r.Precision < 0 {
+		return "%.2f"
+	}
+	return "%." + strconv.Itoa(r.Precision) + "f"
+}
@@ -2,134 +2,598 @@ package output
 
 import (
 	"encoding/json"
-	"fmt"
+	"math"
 	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/history"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
 )
 
+// SchemaVersion is the version of the JSON output. It goes up when a field
+// is renamed, removed or changes meaning; adding one leaves it alone.
+const SchemaVersion = 1
+
 type JSONOutput struct {
-	Timestamp   time.Time  `json:"timestamp"`
-	Download    Download   `json:"download"`
-	Latency     Latency    `json:"latency"`
-	Jitter      Jitter     `json:"jitter,omitempty"`
-	Bufferbloat Bufferbloat `json:"bufferbloat,omitempty"`
-	Health      Health     `json:"health"`
+	Schema      int               `json:"schema_version"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Status      string            `json:"status,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Download    *Download         `json:"download,omitempty"`
+	Upload      *Upload           `json:"upload,omitempty"`
+	Latency     *Latency          `json:"latency,omitempty"`
+	Jitter      *Jitter           `json:"jitter,omitempty"`
+	Bufferbloat *Bufferbloat      `json:"bufferbloat,omitempty"`
+	BloatByDir  []Bufferbloat     `json:"bufferbloat_directions,omitempty"`
+	Health      Health            `json:"health"`
+	Verdict     string            `json:"verdict,omitempty"`
+	Ports       []Port            `json:"ports,omitempty"`
+	Ping        *Ping             `json:"ping,omitempty"`
+	Traceroute  *Traceroute       `json:"traceroute,omitempty"`
+	OneWay      *OneWay           `json:"one_way,omitempty"`
+	Direction   *Direction        `json:"direction,omitempty"`
+	TLS         *TLS              `json:"tls,omitempty"`
+	History     *History          `json:"history,omitempty"`
+	DataUsed    int64             `json:"data_used_bytes,omitempty"`
+	DNSFallback map[string]string `json:"dns_fallback,omitempty"`
+	Methodology *Methodology      `json:"methodology,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// Methodology records the parameters a result was measured with. Metrics
+// lists the phases that ran. FileBytes is omitted for a custom URL, whose
+// size PulseGo does not choose; jitter fields are omitted when jitter was
+// not measured. The download speed includes the TCP ramp-up (Warmup is
+// always 0s) and failed downloads are not retried.
+type Methodology struct {
+	Backend              string   `json:"backend"`
+	URL                  string   `json:"url"`
+	FileBytes            int64    `json:"file_bytes,omitempty"`
+	Connections          int      `json:"connections"`
+	Metrics              []string `json:"metrics"`
+	Mode                 string   `json:"mode"`
+	Timeout              string   `json:"timeout"`
+	Warmup               string   `json:"warmup"`
+	KeepAlive            bool     `json:"keepalive"`
+	Compression          bool     `json:"compression"`
+	HTTP3                bool     `json:"http3"`
+	DSCP                 string   `json:"dscp,omitempty"`
+	DataBudget           int64    `json:"data_budget_bytes,omitempty"`
+	LoadedLatency        bool     `json:"loaded_latency"`
+	JitterSamples        int      `json:"jitter_samples,omitempty"`
+	JitterInterval       string   `json:"jitter_interval,omitempty"`
+	Bufferbloat          bool     `json:"bufferbloat"`
+	BufferbloatDirection string   `json:"bufferbloat_direction,omitempty"`
+	UserAgent            string   `json:"user_agent"`
+	Version              string   `json:"version"`
+
+	// Requests is the -requests target of a stress run.
+	Requests int `json:"requests,omitempty"`
+
+	// Resolve maps each host pinned with -resolve to the IP connected to.
+	Resolve map[string]string `json:"resolve,omitempty"`
+}
+
+type OneWay struct {
+	UpstreamMs   float64 `json:"upstream_ms"`
+	DownstreamMs float64 `json:"downstream_ms"`
+	RTTMs        float64 `json:"rtt_ms"`
+	Samples      int     `json:"samples"`
+	SkewSuspect  bool    `json:"clock_skew_suspected,omitempty"`
+}
+
+// Direction compares the timing of a minimal GET and a small POST; see
+// metrics.DirectionResult for how rough the estimate is.
+type Direction struct {
+	GetWriteMs   float64 `json:"get_write_ms"`
+	GetWaitMs    float64 `json:"get_wait_ms"`
+	PostWriteMs  float64 `json:"post_write_ms"`
+	PostWaitMs   float64 `json:"post_wait_ms"`
+	BodyBytes    int     `json:"post_bytes"`
+	UploadCostMs float64 `json:"upload_cost_ms"`
+	UpstreamMbps float64 `json:"upstream_mbps_estimate,omitempty"`
+	Bottleneck   string  `json:"bottleneck,omitempty"`
+	Samples      int     `json:"samples"`
+}
+
+// TLS is the -strict-tls check of the server's TLS configuration.
+type TLS struct {
+	Version    string   `json:"version,omitempty"`
+	Cipher     string   `json:"cipher,omitempty"`
+	Subject    string   `json:"subject,omitempty"`
+	Issuer     string   `json:"issuer,omitempty"`
+	NotAfter   string   `json:"not_after,omitempty"`
+	DaysLeft   int      `json:"days_left,omitempty"`
+	Violations []string `json:"violations"`
+}
+
+// History compares the run with earlier ones to the same target. Deltas
+// are percentages of the averages.
+type History struct {
+	Run              int     `json:"run"`
+	Window           string  `json:"window"`
+	WindowRuns       int     `json:"window_runs"`
+	DownloadAvgMbps  float64 `json:"download_avg_mbps,omitempty"`
+	DownloadDeltaPct float64 `json:"download_delta_pct,omitempty"`
+	LatencyAvgMs     float64 `json:"latency_avg_ms,omitempty"`
+	LatencyDeltaPct  float64 `json:"latency_delta_pct,omitempty"`
+	JitterAvgMs      float64 `json:"jitter_avg_ms,omitempty"`
+	JitterDeltaPct   float64 `json:"jitter_delta_pct,omitempty"`
+}
+
+type Port struct {
+	Host        string  `json:"host"`
+	Port        int     `json:"port"`
+	Proto       string  `json:"proto"`
+	State       string  `json:"state"`
+	ConnectTime float64 `json:"connect_ms,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type Ping struct {
+	Addr     string  `json:"addr"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	LossPct  float64 `json:"loss_pct"`
+	MinMs    float64 `json:"min_ms"`
+	AvgMs    float64 `json:"avg_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	JitterMs float64 `json:"jitter_ms"`
+}
+
+// Traceroute lists the hops towards Target; a hop whose Addr is empty did
+// not answer.
+type Traceroute struct {
+	Target  string `json:"target"`
+	Reached bool   `json:"reached"`
+	Hops    []Hop  `json:"hops"`
+}
+
+type Hop struct {
+	TTL   int     `json:"ttl"`
+	Addr  string  `json:"addr,omitempty"`
+	RTTMs float64 `json:"rtt_ms,omitempty"`
 }
 
 type Download struct {
-	SpeedMbps   float64 `json:"speed_mbps"`
-	BytesTotal  int64   `json:"bytes_total"`
-	Duration    string  `json:"duration"`
+	SpeedMbps    float64 `json:"speed_mbps"`
+	BytesTotal   int64   `json:"bytes_total"`
+	BytesDecoded int64   `json:"bytes_decompressed"`
+	Duration     string  `json:"duration"`
+	Connections  int     `json:"connections"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	TTLB         string  `json:"ttlb"`
+	StallCount   int     `json:"stall_count"`
+	LongestStall string  `json:"longest_stall"`
+	RampTime     string  `json:"ramp_time"`
+
+	UnknownLength bool   `json:"content_length_unknown,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+	TCP           *TCP   `json:"tcp,omitempty"`
+
+	WindowLimit *WindowLimit `json:"window_limit,omitempty"`
+
+	// Requests and RequestsPerSec count the successful requests of a
+	// stress run.
+	Requests       int     `json:"requests,omitempty"`
+	RequestsPerSec float64 `json:"requests_per_second,omitempty"`
+
+	// FairnessIndex is Jain's fairness index of the per-connection speeds,
+	// from 1/connections to 1 for a perfectly even split.
+	FairnessIndex float64 `json:"fairness_index,omitempty"`
+	Fairness      string  `json:"fairness,omitempty"`
+}
+
+// WindowLimit is the most one TCP connection can carry with the assumed
+// receive window at the measured RTT, next to the fastest connection.
+type WindowLimit struct {
+	WindowBytes int64   `json:"window_bytes"`
+	RTTMs       float64 `json:"rtt_ms"`
+	MaxMbps     float64 `json:"max_mbps_per_connection"`
+	FastestMbps float64 `json:"fastest_connection_mbps"`
+	Bound       bool    `json:"window_bound"`
+}
+
+// Upload is the -upload measurement. AsymmetryRatio is download speed
+// over upload speed, when both were measured.
+type Upload struct {
+	SpeedMbps      float64 `json:"speed_mbps"`
+	BytesTotal     int64   `json:"bytes_total"`
+	Duration       string  `json:"duration"`
+	Connections    int     `json:"connections"`
+	AsymmetryRatio float64 `json:"asymmetry_ratio,omitempty"`
+	UploadBound    bool    `json:"upload_bound,omitempty"`
+}
+
+// TCP is the kernel's TCP_INFO for the download connections, on platforms
+// that provide it.
+type TCP struct {
 	Connections int     `json:"connections"`
+	Retransmits int     `json:"retransmits"`
+	RTTMs       float64 `json:"rtt_ms"`
+	RTTVarMs    float64 `json:"rttvar_ms"`
 }
 
 type Latency struct {
-	TTFB    string `json:"ttfb"`
-	Total   string `json:"total"`
+	TTFB     string `json:"ttfb"`
+	Total    string `json:"total"`
+	Protocol string `json:"protocol,omitempty"`
+	Loaded   string `json:"loaded,omitempty"`
+
+	// ConnReused is whether the probe went out on a pooled connection,
+	// when the transport reported it; ConnIdle is how long that connection
+	// had been idle.
+	ConnReused *bool  `json:"conn_reused,omitempty"`
+	ConnIdle   string `json:"conn_idle,omitempty"`
+
+	ServerTiming []ServerTiming `json:"server_timing,omitempty"`
+}
+
+type ServerTiming struct {
+	Name        string  `json:"name"`
+	DurationMs  float64 `json:"dur_ms,omitempty"`
+	Description string  `json:"desc,omitempty"`
 }
 
 type Jitter struct {
-	Value       string  `json:"value"`
-	Min         string  `json:"min"`
-	Max         string  `json:"max"`
-	PacketLoss float64 `json:"packet_loss_percent"`
+	Value      string            `json:"value"`
+	Min        string            `json:"min"`
+	Max        string            `json:"max"`
+	PacketLoss float64           `json:"packet_loss_percent"`
+	Timeouts   int               `json:"timeouts"`
+	ConnErrors int               `json:"conn_errors"`
+	NoResponse int               `json:"no_responses"`
+	Histogram  []HistogramBucket `json:"histogram,omitempty"`
+
+	Insufficient bool `json:"insufficient,omitempty"`
+}
+
+type HistogramBucket struct {
+	Range string  `json:"range"`
+	MinMs float64 `json:"min_ms"`
+	MaxMs float64 `json:"max_ms,omitempty"`
+	Count int     `json:"count"`
 }
 
 type Bufferbloat struct {
-	Severity string `json:"severity"`
-	Delta    string `json:"delta"`
+	Direction      string  `json:"direction,omitempty"`
+	Severity       string  `json:"severity"`
+	Delta          string  `json:"delta"`
+	RPM            float64 `json:"rpm,omitempty"`
+	Responsiveness string  `json:"responsiveness,omitempty"`
 }
 
 type Health struct {
-	Grade  string `json:"grade"`
-	Score  int    `json:"score"`
-	Level  string `json:"level"`
+	Grade      string      `json:"grade"`
+	Score      int         `json:"score"`
+	Level      string      `json:"level"`
+	Components []Component `json:"components,omitempty"`
+}
+
+type Report struct {
+	Latency     *metrics.LatencyResult
+	Download    *engine.Result
+	Jitter      *metrics.JitterResult
+	Bufferbloat *metrics.BufferbloatResult
+	Health      *metrics.HealthScore
+
+	// BufferbloatDirections holds each direction's result when bufferbloat
+	// was measured under more than the download load; Bufferbloat is then
+	// the worst of them.
+	BufferbloatDirections []*metrics.BufferbloatResult
+	Ports                 []*metrics.PortResult
+	Ping                  *metrics.PingResult
+	Traceroute            *metrics.TracerouteResult
+	OneWay                *metrics.OneWayResult
+	WindowLimit           *metrics.WindowLimit
+	Direction             *metrics.DirectionResult
+	Upload                *metrics.UploadResult
+	TLS                   *metrics.TLSResult
+	History               *history.Trend
+	Stress                bool
+
+	// Asymmetry is the download:upload ratio when both were measured, and
+	// Asymmetric is set when it exceeds -asymmetry-warn.
+	Asymmetry  float64
+	Asymmetric bool
+
+	// Methodology is how the result was measured; only the full JSON
+	// output includes it.
+	Methodology *Methodology
+
+	// DataUsed is the data received over the whole run, set when it ran
+	// under a -data-budget.
+	DataUsed int64
+
+	// DNSFallback maps each host the system resolver failed on to the
+	// fallback resolver that answered for it.
+	DNSFallback map[string]string
+
+	// MedianLatency is the median of several warm latency samples. The
+	// health score uses it instead of the single cold Latency measurement.
+	MedianLatency time.Duration
+
+	// Failure is set when the run completed but its result must not be
+	// trusted, such as when too many requests failed.
+	Failure string `json:"-"`
+
+	// Rendering options. Precision is the number of decimals for Mbps
+	// values, or -1 to keep the defaults; Fields limits JSON and CSV
+	// output to the named fields.
+	Scale     metrics.GradeScale `json:"-"`
+	Precision int                `json:"-"`
+	Fields    []string           `json:"-"`
+	Tags      map[string]string  `json:"-"`
+
+	// Explain adds the score breakdown to text and JSON output.
+	Explain bool `json:"-"`
 }
 
-func FormatJSON(downloadSpeed float64, bytes int64, duration time.Duration, connections int, latency, jitter, bbloat time.Duration, jitterLoss float64, bloatSeverity string, grade string, score int) string {
+func FormatJSON(r *Report) string {
+	if len(r.Fields) > 0 {
+		return formatFieldsJSON(r)
+	}
+
 	out := JSONOutput{
-		Timestamp: time.Now(),
-		Download: Download{
-			SpeedMbps:   downloadSpeed,
-			BytesTotal:  bytes,
-			Duration:    duration.Round(time.Millisecond).String(),
-			Connections: connections,
-		},
-		Latency: Latency{
-			TTFB:  latency.Round(time.Millisecond).String(),
-			Total: latency.Round(time.Millisecond).String(),
-		},
-		Jitter: Jitter{
-			Value:       jitter.Round(time.Millisecond).String(),
-			PacketLoss: jitterLoss,
-		},
-		Bufferbloat: Bufferbloat{
-			Severity: bloatSeverity,
-			Delta:    bbloat.Round(time.Millisecond).String(),
-		},
+		Schema:      SchemaVersion,
+		Timestamp:   time.Now(),
+		Error:       r.Failure,
+		Verdict:     r.Health.Verdict(),
+		DataUsed:    r.DataUsed,
+		DNSFallback: r.DNSFallback,
+		Methodology: r.Methodology,
+		Tags:        r.Tags,
 		Health: Health{
-			Grade: grade,
-			Score: score,
-			Level: getLevel(grade),
+			Grade: r.Health.Grade,
+			Score: r.Health.Score,
+			Level: r.Health.Level,
 		},
 	}
 
-	data, _ := json.MarshalIndent(out, "", "  ")
-	return string(data)
-}
+	if r.Explain {
+		out.Health.Components = components(r.Health)
+	}
+	if r.Failure != "" {
+		out.Status = "failed"
+	}
+	if r.Download != nil {
+		out.Download = &Download{
+			SpeedMbps:    r.mbps(r.Download.DownloadSpeed),
+			BytesTotal:   r.Download.BytesReceived,
+			BytesDecoded: r.Download.DecompressedBytes,
+			Duration:     RoundDuration(r.Download.Duration).String(),
+			Connections:  r.Download.Connections,
+			Errors:       r.Download.Errors,
+			ErrorRate:    r.Download.ErrorRate,
+			TTLB:         RoundDuration(r.Download.TimeToLastByte).String(),
+			StallCount:   r.Download.StallCount,
+			LongestStall: RoundDuration(r.Download.LongestStall).String(),
+			RampTime:     RoundDuration(r.Download.RampTime).String(),
 
-func FormatJSONSimple(mbps float64) string {
-	out := map[string]float64{"download_mbps": mbps}
-	data, _ := json.Marshal(out)
-	return string(data)
-}
+			UnknownLength: r.Download.UnknownLength,
+		}
+		if index, ok := r.fairness(); ok {
+			out.Download.FairnessIndex = math.Round(index*1000) / 1000
+			out.Download.Fairness = metrics.FairnessNote(index)
+		}
+		if r.Stress {
+			ok := r.Download.Requests - r.Download.Errors
+			out.Download.Requests = ok
+			out.Download.RequestsPerSec = perSecond(ok, r.Download.Duration)
+		}
+		if len(r.Download.Checksums) > 0 {
+			out.Download.SHA256 = r.Download.Checksums[0]
+		}
+		if t := r.Download.TCP; t != nil {
+			out.Download.TCP = &TCP{
+				Connections: t.Connections,
+				Retransmits: t.Retransmits,
+				RTTMs:       float64(t.RTT) / float64(time.Millisecond),
+				RTTVarMs:    float64(t.RTTVar) / float64(time.Millisecond),
+			}
+		}
+	}
+	if w := r.WindowLimit; w != nil && out.Download != nil {
+		out.Download.WindowLimit = &WindowLimit{
+			WindowBytes: w.Window,
+			RTTMs:       float64(w.RTT) / float64(time.Millisecond),
+			MaxMbps:     r.mbps(w.MaxMbps),
+			FastestMbps: r.mbps(w.FastestMbps),
+			Bound:       w.Bound,
+		}
+	}
+	if u := r.Upload; u != nil {
+		out.Upload = &Upload{
+			SpeedMbps:      r.mbps(u.Mbps),
+			BytesTotal:     u.Bytes,
+			Duration:       RoundDuration(u.Duration).String(),
+			Connections:    u.Streams,
+			AsymmetryRatio: math.Round(r.Asymmetry*10) / 10,
+			UploadBound:    r.Asymmetric,
+		}
+	}
+	if r.Latency != nil {
+		out.Latency = &Latency{
+			TTFB:     RoundDuration(r.Latency.TTFB).String(),
+			Total:    RoundDuration(r.Latency.Latency).String(),
+			Protocol: r.Latency.Protocol,
+		}
+		if r.Latency.ConnTraced {
+			reused := r.Latency.Reused
+			out.Latency.ConnReused = &reused
+			if r.Latency.WasIdle {
+				out.Latency.ConnIdle = RoundDuration(r.Latency.IdleTime).String()
+			}
+		}
+		for _, st := range r.Latency.ServerTiming {
+			out.Latency.ServerTiming = append(out.Latency.ServerTiming, ServerTiming{
+				Name:        st.Name,
+				DurationMs:  float64(st.Duration) / float64(time.Millisecond),
+				Description: st.Description,
+			})
+		}
+	}
+	if r.Download != nil && r.Download.LoadedLatency > 0 {
+		if out.Latency == nil {
+			out.Latency = &Latency{}
+		}
+		out.Latency.Loaded = RoundDuration(r.Download.LoadedLatency).String()
+	}
+	if r.Jitter != nil {
+		out.Jitter = &Jitter{
+			Value:      RoundDuration(r.Jitter.Jitter).String(),
+			Min:        RoundDuration(r.Jitter.MinLatency).String(),
+			Max:        RoundDuration(r.Jitter.MaxLatency).String(),
+			PacketLoss: r.Jitter.PacketLoss,
+			Timeouts:   r.Jitter.Timeouts,
+			ConnErrors: r.Jitter.ConnErrors,
+			NoResponse: r.Jitter.NoResponses,
+			Histogram:  histogramBuckets(r.Jitter.Histogram),
+
+			Insufficient: r.Jitter.Insufficient,
+		}
+	}
+	if r.Bufferbloat != nil {
+		b := bufferbloatJSON(r.Bufferbloat)
+		// A download-only measurement keeps its original shape.
+		if r.BufferbloatDirections == nil {
+			b.Direction = ""
+		}
+		out.Bufferbloat = &b
+	}
+	for _, b := range r.BufferbloatDirections {
+		out.BloatByDir = append(out.BloatByDir, bufferbloatJSON(b))
+	}
+
+	if r.OneWay != nil {
+		out.OneWay = &OneWay{
+			UpstreamMs:   float64(r.OneWay.Upstream) / float64(time.Millisecond),
+			DownstreamMs: float64(r.OneWay.Downstream) / float64(time.Millisecond),
+			RTTMs:        float64(r.OneWay.RTT) / float64(time.Millisecond),
+			Samples:      r.OneWay.Samples,
+			SkewSuspect:  r.OneWay.SkewSuspect,
+		}
+	}
+
+	if d := r.Direction; d != nil {
+		out.Direction = &Direction{
+			GetWriteMs:   float64(d.Get.Write) / float64(time.Millisecond),
+			GetWaitMs:    float64(d.Get.Wait) / float64(time.Millisecond),
+			PostWriteMs:  float64(d.Post.Write) / float64(time.Millisecond),
+			PostWaitMs:   float64(d.Post.Wait) / float64(time.Millisecond),
+			BodyBytes:    d.BodyBytes,
+			UploadCostMs: float64(d.UploadCost) / float64(time.Millisecond),
+			UpstreamMbps: math.Round(d.UpstreamMbps*100) / 100,
+			Bottleneck:   d.Bottleneck(r.downloadMbps()),
+			Samples:      d.Samples,
+		}
+	}
 
-func FormatPrometheus(downloadSpeed float64, latency, jitter time.Duration, score int, grade string) string {
-	return fmt.Sprintf(`# HELP pulsego_download_speed Download speed in Mbps
-# TYPE pulsego_download_speed gauge
-pulsego_download_speed %.2f
+	if t := r.TLS; t != nil {
+		out.TLS = &TLS{
+			Version:    t.Version,
+			Cipher:     t.Cipher,
+			Subject:    t.Subject,
+			Issuer:     t.Issuer,
+			Violations: t.Violations,
+		}
+		if !t.NotAfter.IsZero() {
+			out.TLS.NotAfter = t.NotAfter.UTC().Format(time.RFC3339)
+			out.TLS.DaysLeft = int(time.Until(t.NotAfter).Hours() / 24)
+		}
+		if out.TLS.Violations == nil {
+			out.TLS.Violations = []string{}
+		}
+	}
 
-# HELP pulsego_latency Latency in milliseconds
-# TYPE pulsego_latency gauge
-pulsego_latency %.2f
+	if h := r.History; h != nil {
+		out.History = &History{
+			Run:              h.Runs,
+			Window:           h.Window.String(),
+			WindowRuns:       h.WindowRuns,
+			DownloadAvgMbps:  r.mbps(h.DownloadAvg),
+			DownloadDeltaPct: math.Round(h.DownloadDelta*1000) / 10,
+			LatencyAvgMs:     math.Round(h.LatencyAvg*100) / 100,
+			LatencyDeltaPct:  math.Round(h.LatencyDelta*1000) / 10,
+			JitterAvgMs:      math.Round(h.JitterAvg*100) / 100,
+			JitterDeltaPct:   math.Round(h.JitterDelta*1000) / 10,
+		}
+	}
 
-# HELP pulsego_jitter Jitter in milliseconds
-# TYPE pulsego_jitter gauge
-pulsego_jitter %.2f
+	for _, p := range r.Ports {
+		out.Ports = append(out.Ports, Port{
+			Host:        p.Host,
+			Port:        p.Port,
+			Proto:       p.Proto,
+			State:       p.State,
+			ConnectTime: float64(p.ConnectTime) / float64(time.Millisecond),
+			Error:       p.Error,
+		})
+	}
+	if p := r.Ping; p != nil {
+		out.Ping = &Ping{
+			Addr:     p.Addr,
+			Sent:     p.Sent,
+			Received: p.Received,
+			LossPct:  math.Round(p.Loss()*10) / 10,
+			MinMs:    ms(p.Min),
+			AvgMs:    ms(p.Avg),
+			MaxMs:    ms(p.Max),
+			JitterMs: ms(p.Jitter),
+		}
+	}
+	if t := r.Traceroute; t != nil {
+		out.Traceroute = tracerouteJSON(t)
+	}
 
-# HELP pulsego_health_score Health score (0-100)
-# TYPE pulsego_health_score gauge
-pulsego_health_score %d
+	data, _ := json.MarshalIndent(out, "", "  ")
+	return string(data)
+}
 
-# HELP pulsego_health_grade Health grade (A=5, B=4, C=3, D=2, F=1)
-# TYPE pulsego_health_grade gauge
-pulsego_health_grade %d
-`, downloadSpeed, float64(latency.Milliseconds()), float64(jitter.Milliseconds()), score, gradeValue(grade))
+// downloadMbps is the measured download speed, or 0 when the download
+// phase did not run.
+func (r *Report) downloadMbps() float64 {
+	if r.Download == nil {
+		return 0
+	}
+	return r.Download.DownloadSpeed
 }
 
-func getLevel(grade string) string {
-	switch grade {
-	case "A":
-		return "Gold"
-	case "B":
-		return "Silver"
-	case "C":
-		return "Bronze"
-	default:
-		return "Basic"
+func bufferbloatJSON(b *metrics.BufferbloatResult) Bufferbloat {
+	return Bufferbloat{
+		Direction:      b.Direction,
+		Severity:       b.Severity,
+		Delta:          RoundDuration(b.BloatDelta).String(),
+		RPM:            math.Round(b.RPM),
+		Responsiveness: b.Responsiveness,
 	}
 }
 
-func gradeValue(grade string) int {
-	switch grade {
-	case "A":
-		return 5
-	case "B":
-		return 4
-	case "C":
-		return 3
-	case "D":
-		return 2
-	default:
-		return 1
+func histogramBuckets(h *metrics.Histogram) []HistogramBucket {
+	if h == nil {
+		return nil
+	}
+
+	labels := h.Labels()
+	buckets := make([]HistogramBucket, len(h.Counts))
+	var lower time.Duration
+	for i, count := range h.Counts {
+		buckets[i] = HistogramBucket{
+			Range: labels[i],
+			MinMs: float64(lower) / float64(time.Millisecond),
+			Count: count,
+		}
+		if i < len(h.Bounds) {
+			buckets[i].MaxMs = float64(h.Bounds[i]) / float64(time.Millisecond)
+			lower = h.Bounds[i]
+		}
 	}
+	return buckets
+}
+
+func FormatJSONSimple(mbps float64) string {
+	out := map[string]float64{"download_mbps": mbps}
+	data, _ := json.Marshal(out)
+	return string(data)
 }
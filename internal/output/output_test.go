@@ -0,0 +1,121 @@
+package output
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/engine"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+func TestFormatJSONSkippedLatency(t *testing.T) {
+	download := &engine.Result{DownloadSpeed: 80, BytesReceived: 10 << 20, Duration: time.Second}
+	tests := []struct {
+		name    string
+		latency *metrics.LatencyResult
+		want    bool
+	}{
+		{"latency skipped", nil, false},
+		{"latency measured", &metrics.LatencyResult{Latency: 20 * time.Millisecond, TTFB: 15 * time.Millisecond}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Report{
+				Download:  download,
+				Latency:   tt.latency,
+				Health:    metrics.CalculateHealthScore(80, nil, 0, "Unknown", metrics.DefaultGradeScale),
+				Precision: -1,
+			}
+			var out map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(FormatJSON(r)), &out); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := out["latency"]; ok != tt.want {
+				t.Errorf("latency key present = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownLengthNote(t *testing.T) {
+	tests := []struct {
+		name    string
+		unknown bool
+	}{
+		{"content length", false},
+		{"no content length", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Report{
+				Download: &engine.Result{
+					DownloadSpeed: 80, BytesReceived: 10 << 20, Duration: time.Second,
+					UnknownLength: tt.unknown,
+				},
+				Health:    metrics.CalculateHealthScore(80, nil, 0, "Unknown", metrics.DefaultGradeScale),
+				Precision: -1,
+			}
+			text := FormatText(r)
+			if got := strings.Contains(text, "no Content-Length"); got != tt.unknown {
+				t.Errorf("text note present = %v, want %v:\n%s", got, tt.unknown, text)
+			}
+			var out JSONOutput
+			if err := json.Unmarshal([]byte(FormatJSON(r)), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Download == nil || out.Download.UnknownLength != tt.unknown {
+				t.Errorf("content_length_unknown = %+v, want %v", out.Download, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestRoundDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{1234 * time.Nanosecond, "1µs"},
+		{850_400 * time.Nanosecond, "850µs"},
+		{-850_400 * time.Nanosecond, "-850µs"},
+		{1_400 * time.Microsecond, "1ms"},
+		{1_234_567 * time.Microsecond, "1.235s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := RoundDuration(tt.d).String(); got != tt.want {
+				t.Errorf("RoundDuration(%d) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormatSubMillisecond renders a download that finished in
+// microseconds, as on loopback, which must not print as 0s.
+func TestFormatSubMillisecond(t *testing.T) {
+	r := &Report{
+		Download: &engine.Result{
+			DownloadSpeed: 8, BytesReceived: 1000,
+			Duration: 180 * time.Microsecond, TimeToLastByte: 150 * time.Microsecond,
+		},
+		Health:    metrics.CalculateHealthScore(8, nil, 0, "Unknown", metrics.DefaultGradeScale),
+		Precision: -1,
+	}
+	text := FormatText(r)
+	for _, want := range []string{"180µs", "150µs"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text output lacks %s:\n%s", want, text)
+		}
+	}
+	var out JSONOutput
+	if err := json.Unmarshal([]byte(FormatJSON(r)), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Download.Duration != "180µs" || out.Download.TTLB != "150µs" {
+		t.Errorf("JSON duration %q, last byte %q; want 180µs and 150µs",
+			out.Download.Duration, out.Download.TTLB)
+	}
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+var tagKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseTag splits a key=value pair and checks that the key is usable as a
+// Prometheus label name.
+func ParseTag(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok {
+		return "", "", fmt.Errorf("invalid tag %q, expected key=value", s)
+	}
+	if !tagKeyPattern.MatchString(key) || strings.HasPrefix(key, "__") {
+		return "", "", fmt.Errorf("invalid tag key %q: use letters, digits and underscores, not starting with a digit or __", key)
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+type promWriter struct {
+	sb     strings.Builder
+	labels []string
+}
+
+func newPromWriter(tags map[string]string) *promWriter {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p := &promWriter{}
+	for _, k := range keys {
+		p.labels = append(p.labels, fmt.Sprintf("%s=%q", k, tags[k]))
+	}
+	return p
+}
+
+func (p *promWriter) header(name, help string) {
+	if p.sb.Len() > 0 {
+		p.sb.WriteString("\n")
+	}
+	fmt.Fprintf(&p.sb, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+func (p *promWriter) sample(name, value string, extra ...string) {
+	labels := append(append([]string{}, p.labels...), extra...)
+	if len(labels) > 0 {
+		name += "{" + strings.Join(labels, ",") + "}"
+	}
+	fmt.Fprintf(&p.sb, "%s %s\n", name, value)
+}
+
+func (p *promWriter) gauge(name, help, value string) {
+	p.header(name, help)
+	p.sample(name, value)
+}
+
+func FormatPrometheus(r *Report) string {
+	var latency, jitter time.Duration
+	if r.Latency != nil {
+		latency = r.Latency.Latency
+	}
+	if r.Jitter != nil {
+		jitter = r.Jitter.Jitter
+	}
+	jitterValue := fmt.Sprintf("%.2f", float64(jitter.Milliseconds()))
+	if r.Jitter != nil && r.Jitter.Insufficient {
+		jitterValue = "NaN"
+	}
+
+	p := newPromWriter(r.Tags)
+	if r.Download != nil {
+		p.gauge("pulsego_download_speed", "Download speed in Mbps", fmt.Sprintf(r.mbpsFormat(), r.Download.DownloadSpeed))
+	}
+	if r.Upload != nil {
+		p.gauge("pulsego_upload_speed", "Upload speed in Mbps", fmt.Sprintf(r.mbpsFormat(), r.Upload.Mbps))
+	}
+	if r.Asymmetry > 0 {
+		p.gauge("pulsego_asymmetry_ratio", "Download speed divided by upload speed", fmt.Sprintf("%.2f", r.Asymmetry))
+	}
+	p.gauge("pulsego_latency", "Latency in milliseconds", fmt.Sprintf("%.2f", float64(latency.Milliseconds())))
+	if r.Download != nil && r.Download.LoadedLatency > 0 {
+		p.gauge("pulsego_loaded_latency", "Latency during the download in milliseconds",
+			fmt.Sprintf("%.2f", float64(r.Download.LoadedLatency)/float64(time.Millisecond)))
+	}
+	p.gauge("pulsego_jitter", "Jitter in milliseconds", jitterValue)
+	if r.Download != nil {
+		p.gauge("pulsego_download_stalls", "Number of stalls during the download", fmt.Sprintf("%d", r.Download.StallCount))
+		p.gauge("pulsego_download_longest_stall", "Longest download stall in milliseconds",
+			fmt.Sprintf("%.2f", float64(r.Download.LongestStall.Milliseconds())))
+	}
+	if r.Download != nil && r.Download.TCP != nil {
+		p.gauge("pulsego_tcp_retransmits", "TCP segments retransmitted on the download connections", fmt.Sprintf("%d", r.Download.TCP.Retransmits))
+		p.gauge("pulsego_tcp_rtt", "Kernel smoothed TCP round-trip time in milliseconds",
+			fmt.Sprintf("%.2f", float64(r.Download.TCP.RTT)/float64(time.Millisecond)))
+	}
+	p.gauge("pulsego_health_score", "Health score (0-100)", fmt.Sprintf("%d", r.Health.Score))
+	p.gauge("pulsego_health_grade", fmt.Sprintf("Health grade (%s)", gradeHelp(r.Scale)), fmt.Sprintf("%d", r.Health.GradeValue))
+
+	if r.Bufferbloat != nil {
+		p.gauge("pulsego_responsiveness_rpm", "Round-trips per minute under load", fmt.Sprintf("%.0f", r.Bufferbloat.RPM))
+	}
+	if len(r.BufferbloatDirections) > 0 {
+		p.header("pulsego_bufferbloat_delta", "Latency increase under load in milliseconds, by load direction")
+		for _, b := range r.BufferbloatDirections {
+			p.sample("pulsego_bufferbloat_delta", fmt.Sprintf("%.2f", float64(b.BloatDelta)/float64(time.Millisecond)),
+				fmt.Sprintf("direction=%q", b.Direction))
+		}
+	}
+
+	if len(r.Ports) > 0 {
+		p.header("pulsego_port_open", "Port reachability (1=open, 0=closed or filtered)")
+		for _, port := range r.Ports {
+			open := "0"
+			if port.State == metrics.PortOpen {
+				open = "1"
+			}
+			p.sample("pulsego_port_open", open,
+				fmt.Sprintf("host=%q", port.Host),
+				fmt.Sprintf("port=\"%d\"", port.Port),
+				fmt.Sprintf("proto=%q", port.Proto),
+				fmt.Sprintf("state=%q", port.State))
+		}
+	}
+
+	return p.sb.String()
+}
+
+func gradeHelp(scale metrics.GradeScale) string {
+	parts := []string{}
+	for _, g := range scale.Grades() {
+		band, _ := scale.Band(g)
+		parts = append(parts, fmt.Sprintf("%s=%d", band.Grade, band.Value))
+	}
+	return strings.Join(parts, ", ")
+}
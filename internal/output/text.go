@@ -0,0 +1,294 @@
+package output
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/history"
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+func FormatText(r *Report) string {
+	var sb strings.Builder
+
+	if r.Failure != "" {
+		fmt.Fprintf(&sb, "Test FAILED: %s\n", r.Failure)
+	}
+
+	if r.Download != nil {
+		writeDownload(&sb, r)
+	}
+	if r.Upload != nil {
+		writeUpload(&sb, r)
+	}
+	if r.Latency != nil && len(r.Latency.ServerTiming) > 0 {
+		writeServerTiming(&sb, r.Latency.ServerTiming)
+	}
+	if r.DataUsed > 0 && r.Methodology != nil {
+		fmt.Fprintf(&sb, "Data used: %.1f MB of %.1f MB budget\n",
+			float64(r.DataUsed)/(1<<20), float64(r.Methodology.DataBudget)/(1<<20))
+	}
+	if r.Methodology != nil && r.Methodology.DSCP != "" {
+		fmt.Fprintf(&sb, "QoS marking: DSCP %s\n", r.Methodology.DSCP)
+	}
+	if r.Methodology != nil {
+		for _, host := range slices.Sorted(maps.Keys(r.Methodology.Resolve)) {
+			fmt.Fprintf(&sb, "Pinned: %s to %s\n", host, r.Methodology.Resolve[host])
+		}
+	}
+	for _, host := range slices.Sorted(maps.Keys(r.DNSFallback)) {
+		fmt.Fprintf(&sb, "DNS: system resolver failed for %s, answered by %s\n", host, r.DNSFallback[host])
+	}
+	if r.Jitter != nil {
+		if r.Jitter.Insufficient {
+			fmt.Fprintf(&sb, "Jitter: n/a (too few valid samples) | Loss: %.1f%%\n", r.Jitter.PacketLoss)
+		} else {
+			fmt.Fprintf(&sb, "Jitter: %v | Min: %v | Max: %v | Loss: %.1f%%\n",
+				metrics.FormatDuration(r.Jitter.Jitter), metrics.FormatDuration(r.Jitter.MinLatency), metrics.FormatDuration(r.Jitter.MaxLatency), r.Jitter.PacketLoss)
+		}
+		if r.Jitter.PacketLoss > 0 {
+			fmt.Fprintf(&sb, "Loss breakdown: Timeouts: %d | Connection errors: %d | No response: %d\n",
+				r.Jitter.Timeouts, r.Jitter.ConnErrors, r.Jitter.NoResponses)
+		}
+		if r.Jitter.Histogram != nil {
+			sb.WriteString("Latency distribution:\n")
+			sb.WriteString(r.Jitter.Histogram.Bars(20))
+		}
+	}
+	if r.OneWay != nil {
+		fmt.Fprintf(&sb, "One-way delay: Up %v | Down %v (assumes synchronized clocks)\n",
+			metrics.FormatDuration(r.OneWay.Upstream), metrics.FormatDuration(r.OneWay.Downstream))
+		if r.OneWay.SkewSuspect {
+			sb.WriteString("Warning: a negative direction means the client and server clocks are out of sync\n")
+		}
+	}
+	if d := r.Direction; d != nil {
+		fmt.Fprintf(&sb, "Direction: GET %v | POST %dKB %v (+%v",
+			metrics.FormatDuration(d.Get.Total()), d.BodyBytes/1024, metrics.FormatDuration(d.Post.Total()), metrics.FormatDuration(d.UploadCost))
+		if d.UpstreamMbps > 0 {
+			fmt.Fprintf(&sb, ", ~%.0f Mbps up", d.UpstreamMbps)
+		}
+		sb.WriteString(")")
+		if b := d.Bottleneck(r.downloadMbps()); b != "" {
+			fmt.Fprintf(&sb, " | Bottleneck: %s (rough estimate)", b)
+		}
+		sb.WriteString("\n")
+	}
+	if t := r.TLS; t != nil {
+		writeTLS(&sb, t)
+	}
+	if len(r.BufferbloatDirections) > 0 {
+		for _, b := range r.BufferbloatDirections {
+			fmt.Fprintf(&sb, "Bufferbloat (%s): %s (Delta %v) | Responsiveness: %.0f RPM (%s)\n",
+				bloatLabel(b.Direction), b.Severity, metrics.FormatDuration(b.BloatDelta), b.RPM, b.Responsiveness)
+		}
+	} else if r.Bufferbloat != nil {
+		fmt.Fprintf(&sb, "Bufferbloat: %s (Delta %v) | Responsiveness: %.0f RPM (%s)\n",
+			r.Bufferbloat.Severity, metrics.FormatDuration(r.Bufferbloat.BloatDelta), r.Bufferbloat.RPM, r.Bufferbloat.Responsiveness)
+	}
+	if len(r.Ports) > 0 {
+		sb.WriteString("Ports:\n")
+		for _, p := range r.Ports {
+			target := fmt.Sprintf("%s:%d/%s", p.Host, p.Port, p.Proto)
+			line := fmt.Sprintf("  %-32s %-9s", target, p.State)
+			if p.ConnectTime > 0 {
+				line += fmt.Sprintf(" %v", metrics.FormatDuration(p.ConnectTime))
+			}
+			sb.WriteString(strings.TrimRight(line, " ") + "\n")
+		}
+	}
+	if p := r.Ping; p != nil {
+		fmt.Fprintf(&sb, "Ping: %s min/avg/max/jitter %v/%v/%v/%v | Loss: %.1f%% (%d/%d)\n", p.Addr,
+			metrics.FormatDuration(p.Min), metrics.FormatDuration(p.Avg), metrics.FormatDuration(p.Max),
+			metrics.FormatDuration(p.Jitter), p.Loss(), p.Sent-p.Received, p.Sent)
+	}
+	if t := r.Traceroute; t != nil {
+		fmt.Fprintf(&sb, "Traceroute to %s:\n", t.Target)
+		for _, h := range t.Hops {
+			if h.Addr == "" {
+				fmt.Fprintf(&sb, "  %2d  *\n", h.TTL)
+				continue
+			}
+			fmt.Fprintf(&sb, "  %2d  %-15s %v\n", h.TTL, h.Addr, metrics.FormatDuration(h.RTT))
+		}
+		if !t.Reached {
+			sb.WriteString("  (target not reached)\n")
+		}
+	}
+	sb.WriteString("\n" + r.Health.String() + "\n")
+	sb.WriteString("Verdict: " + r.Health.Verdict() + "\n")
+	if r.Explain {
+		writeExplain(&sb, r)
+	}
+	if r.History != nil {
+		writeHistory(&sb, r.History)
+	}
+	return sb.String()
+}
+
+func writeDownload(sb *strings.Builder, r *Report) {
+	result := r.Download
+	fmt.Fprintf(sb, "Download: "+r.mbpsFormat()+" Mbps | %.2f MB in %v\n",
+		result.DownloadSpeed,
+		float64(result.BytesReceived)/1_000_000,
+		metrics.FormatDuration(result.Duration),
+	)
+	if result.Capped {
+		sb.WriteString("Note: the download stopped at its share of the data budget\n")
+	}
+	if result.UnknownLength {
+		sb.WriteString("Note: the server sent no Content-Length; downloads ran until the stream ended or the timeout\n")
+	}
+	if len(result.Checksums) > 0 {
+		fmt.Fprintf(sb, "SHA-256: %s", result.Checksums[0])
+		if len(result.Checksums) > 1 {
+			fmt.Fprintf(sb, " (first of %d complete downloads)", len(result.Checksums))
+		}
+		sb.WriteString("\n")
+	}
+	if result.DecompressedBytes != result.BytesReceived {
+		fmt.Fprintf(sb, "Wire: %.2f MB | Decompressed: %.2f MB\n",
+			float64(result.BytesReceived)/1_000_000,
+			float64(result.DecompressedBytes)/1_000_000)
+	}
+	fmt.Fprintf(sb, "Last byte: %v | Stalls: %d",
+		metrics.FormatDuration(result.TimeToLastByte), result.StallCount)
+	if result.StallCount > 0 {
+		fmt.Fprintf(sb, " (longest %v)", metrics.FormatDuration(result.LongestStall))
+	}
+	sb.WriteString("\n")
+	if t := result.TCP; t != nil {
+		fmt.Fprintf(sb, "TCP: %d retransmits | RTT: %v ± %v (kernel, %d connections)\n",
+			t.Retransmits, metrics.FormatDuration(t.RTT), metrics.FormatDuration(t.RTTVar), t.Connections)
+	}
+	if index, ok := r.fairness(); ok {
+		fmt.Fprintf(sb, "Fairness: %.2f across %d connections (%s)\n",
+			index, len(result.ConnectionSpeeds), metrics.FairnessNote(index))
+	}
+	if w := r.WindowLimit; w != nil && w.Bound {
+		fmt.Fprintf(sb, "Hint: with a %dKB receive window at %v RTT one connection carries at most %.0f Mbps, and the fastest reached %.0f Mbps; ",
+			w.Window>>10, metrics.FormatDuration(w.RTT), w.MaxMbps, w.FastestMbps)
+		if w.Connections == 1 {
+			sb.WriteString("a single connection cannot fill a faster link, so raise -downloads\n")
+		} else {
+			sb.WriteString("more connections (-downloads) may be needed to fill a faster link\n")
+		}
+	}
+	if result.LoadedLatency > 0 {
+		fmt.Fprintf(sb, "Latency during download: %v", metrics.FormatDuration(result.LoadedLatency))
+		if r.Latency != nil {
+			fmt.Fprintf(sb, " (idle %v)", metrics.FormatDuration(r.Latency.Latency))
+		}
+		sb.WriteString("\n")
+	}
+	if r.Stress {
+		fmt.Fprintf(sb, "Connections: %d | Peak: %.2f Mbps | Errors: %d (%.0f%%)\n",
+			result.Connections, result.PeakSpeed, result.Errors, result.ErrorRate*100)
+		ok := result.Requests - result.Errors
+		fmt.Fprintf(sb, "Requests: %d in %v (%.1f/s)\n",
+			ok, metrics.FormatDuration(result.Duration), perSecond(ok, result.Duration))
+	} else if result.Errors > 0 {
+		fmt.Fprintf(sb, "Errors: %d of %d connections (%.0f%%)\n",
+			result.Errors, result.Requests, result.ErrorRate*100)
+	}
+}
+
+// writeServerTiming lists the server's own Server-Timing breakdown, which
+// separates its processing time from the network latency.
+func writeServerTiming(sb *strings.Builder, timings []metrics.ServerTiming) {
+	parts := make([]string, len(timings))
+	for i, st := range timings {
+		part := st.Name
+		if st.Duration > 0 {
+			part += " " + metrics.FormatDuration(st.Duration)
+		}
+		if st.Description != "" {
+			part += fmt.Sprintf(" (%s)", st.Description)
+		}
+		parts[i] = part
+	}
+	fmt.Fprintf(sb, "Server timing: %s\n", strings.Join(parts, ", "))
+}
+
+func bloatLabel(dir string) string {
+	switch dir {
+	case metrics.BloatUp:
+		return "upload"
+	case metrics.BloatBoth:
+		return "bidirectional"
+	default:
+		return "download"
+	}
+}
+
+func writeUpload(sb *strings.Builder, r *Report) {
+	u := r.Upload
+	fmt.Fprintf(sb, "Upload: "+r.mbpsFormat()+" Mbps | %.2f MB in %s\n",
+		u.Mbps, float64(u.Bytes)/1_000_000, metrics.FormatDuration(u.Duration))
+	if r.Asymmetry == 0 {
+		return
+	}
+	fmt.Fprintf(sb, "Asymmetry: %.1f:1 (down:up)\n", r.Asymmetry)
+	if r.Asymmetric {
+		sb.WriteString("Note: upload is far slower than download, so video calls, cloud backups and sending large files will be limited by the upload\n")
+	}
+}
+
+func writeTLS(sb *strings.Builder, t *metrics.TLSResult) {
+	if t.Version != "" {
+		fmt.Fprintf(sb, "TLS: %s, %s", t.Version, t.Cipher)
+		if t.Subject != "" {
+			fmt.Fprintf(sb, " | Certificate: %s (issuer %s), expires %s",
+				t.Subject, t.Issuer, t.NotAfter.Format("2006-01-02"))
+		}
+		sb.WriteString("\n")
+	}
+	for _, v := range t.Violations {
+		fmt.Fprintf(sb, "TLS violation: %s\n", v)
+	}
+}
+
+func writeHistory(sb *strings.Builder, t *history.Trend) {
+	fmt.Fprintf(sb, "History: run #%d for this target", t.Runs)
+	if t.WindowRuns == 0 {
+		fmt.Fprintf(sb, "; no earlier runs within the %s window to compare with\n", windowLabel(t.Window))
+		return
+	}
+	var parts []string
+	for _, m := range []struct {
+		name  string
+		delta float64
+		avg   float64
+	}{
+		{"Download", t.DownloadDelta, t.DownloadAvg},
+		{"Latency", t.LatencyDelta, t.LatencyAvg},
+		{"Jitter", t.JitterDelta, t.JitterAvg},
+	} {
+		switch {
+		case m.avg == 0:
+		case math.Abs(m.delta) < 0.005:
+			parts = append(parts, m.name+" on par")
+		case m.delta > 0:
+			parts = append(parts, fmt.Sprintf("%s %.0f%% above", m.name, m.delta*100))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %.0f%% below", m.name, -m.delta*100))
+		}
+	}
+	runs := "runs"
+	if t.WindowRuns == 1 {
+		runs = "run"
+	}
+	fmt.Fprintf(sb, " | vs %s average of %d %s: %s\n", windowLabel(t.Window), t.WindowRuns, runs, strings.Join(parts, ", "))
+}
+
+// windowLabel renders a history window as "7-day" or "12h".
+func windowLabel(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d-day", d/(24*time.Hour))
+	}
+	return d.String()
+}
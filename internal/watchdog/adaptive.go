@@ -0,0 +1,38 @@
+package watchdog
+
+import "time"
+
+// adaptive reports whether the tick interval adapts to the link's health.
+func (w *Watcher) adaptive() bool {
+	return w.Config.AdaptiveMin > 0 && w.Config.AdaptiveMax > 0
+}
+
+// adapt moves the adaptive interval after a tick. A failed tick, an alert
+// or a grade in the lower half of the scale halves it, down to
+// AdaptiveMin, for a closer look at the problem; a tick graded in the top
+// two grades without alerts lengthens it by a quarter, up to AdaptiveMax.
+// Anything in between keeps the current pace.
+func (w *Watcher) adapt(grade string, failed, alerting bool) {
+	if !w.adaptive() {
+		return
+	}
+
+	rank := w.Config.GradeScale.Rank(grade)
+	poor := failed || alerting || rank < 0 || rank >= (len(w.Config.GradeScale.Grades())+1)/2
+	switch {
+	case poor:
+		w.interval /= 2
+	case rank <= 1:
+		w.interval += w.interval / 4
+	}
+	w.interval = min(max(w.interval, w.Config.AdaptiveMin), w.Config.AdaptiveMax)
+}
+
+// currentInterval is the tick interval before any jitter: the adaptive
+// interval when enabled, otherwise Interval.
+func (w *Watcher) currentInterval() time.Duration {
+	if w.adaptive() {
+		return w.interval
+	}
+	return w.Config.Interval
+}
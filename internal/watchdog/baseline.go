@@ -0,0 +1,60 @@
+package watchdog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// baseline collects the first BaselineSamples successful ticks, during
+// which no alerts fire. Its medians are this link's normal latency and
+// jitter.
+type baseline struct {
+	latencies []time.Duration
+	jitters   []time.Duration
+
+	latency time.Duration
+	jitter  time.Duration
+	done    bool
+}
+
+// warmingUp reports whether the watcher is still establishing its
+// baseline and must not alert.
+func (w *Watcher) warmingUp() bool {
+	return w.Config.BaselineSamples > 0 && !w.base.done
+}
+
+// addBaseline records a tick of the warm-up. Once enough have been seen it
+// fixes the baseline and, with RelativeThresholds, moves the latency and
+// jitter thresholds to baseline plus the configured thresholds.
+func (w *Watcher) addBaseline(ts time.Time, latency, jitter time.Duration) {
+	b := &w.base
+	b.latencies = append(b.latencies, latency)
+	b.jitters = append(b.jitters, jitter)
+	if len(b.latencies) < w.Config.BaselineSamples {
+		return
+	}
+
+	b.latency = metrics.Median(b.latencies)
+	b.jitter = metrics.Median(b.jitters)
+	b.done = true
+	b.latencies, b.jitters = nil, nil
+
+	if w.Config.RelativeThresholds {
+		if w.Config.LatencyThreshold > 0 {
+			w.Config.LatencyThreshold += b.latency
+		}
+		if w.Config.JitterThreshold > 0 {
+			w.Config.JitterThreshold += b.jitter
+		}
+	}
+
+	fmt.Printf("\r\033[K[%s] Baseline: latency %v, jitter %v after %d ticks",
+		ts.Format("15:04:05"), metrics.FormatDuration(b.latency), metrics.FormatDuration(b.jitter), w.Config.BaselineSamples)
+	if w.Config.RelativeThresholds {
+		fmt.Printf(" | thresholds now latency > %v, jitter > %v",
+			metrics.FormatDuration(w.Config.LatencyThreshold), metrics.FormatDuration(w.Config.JitterThreshold))
+	}
+	fmt.Println()
+}
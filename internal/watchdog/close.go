@@ -0,0 +1,81 @@
+package watchdog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// closeTimeout bounds Close, so a hook or output stuck on a dead disk or
+// network share cannot keep the process from exiting.
+const closeTimeout = 5 * time.Second
+
+// Close shuts the watcher down once Start has returned, or stops it first
+// if it is still running: queued alert hooks are delivered, the timeline
+// is written to TimelineOut, and the RawSamples, AlertsOut, PlotOut and
+// TimelineOut writers are flushed and closed if they support it. It gives
+// up after closeTimeout and returns an error saying what may have been
+// lost. Calling Close again returns the same result.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		w.halt()
+		done := make(chan error, 1)
+		go func() { done <- w.shutdown() }()
+		select {
+		case w.closeErr = <-done:
+		case <-time.After(closeTimeout):
+			w.closeErr = fmt.Errorf("shutdown did not finish within %v; queued alert hooks and unwritten output may be lost", closeTimeout)
+		}
+	})
+	return w.closeErr
+}
+
+func (w *Watcher) shutdown() error {
+	w.runningMu.Lock()
+	loopDone := w.loopDone
+	w.runningMu.Unlock()
+	if loopDone != nil {
+		<-loopDone
+	}
+
+	if w.stopHooks != nil {
+		w.stopHooks()
+	}
+
+	var errs []error
+	if w.Config.TimelineOut != nil {
+		enc := json.NewEncoder(w.Config.TimelineOut)
+		for _, b := range w.Timeline() {
+			if err := enc.Encode(b); err != nil {
+				errs = append(errs, fmt.Errorf("timeline: %w", err))
+				break
+			}
+		}
+	}
+	for _, out := range []struct {
+		name string
+		w    io.Writer
+	}{
+		{"raw samples", w.Config.RawSamples},
+		{"alert feed", w.Config.AlertsOut},
+		{"plot output", w.Config.PlotOut},
+		{"timeline", w.Config.TimelineOut},
+	} {
+		if out.w == nil {
+			continue
+		}
+		if f, ok := out.w.(interface{ Flush() error }); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", out.name, err))
+			}
+		}
+		if c, ok := out.w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", out.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
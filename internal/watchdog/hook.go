@@ -0,0 +1,133 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// Alert hooks run one at a time from a bounded queue, so a flapping link
+// cannot fork a command per alert. After hookBreakerFailures consecutive
+// failures the hook is paused for hookBreakerCooldown and alerts that
+// arrive meanwhile are dropped.
+const (
+	hookQueueSize       = 16
+	hookBreakerFailures = 5
+	hookBreakerCooldown = time.Minute
+)
+
+// runAlertHook queues the OnAlert command for the hook worker so a slow
+// script never delays the next tick. When the queue is full the alert is
+// dropped.
+func (w *Watcher) runAlertHook(alert Alert) {
+	rec := w.record(alert)
+	select {
+	case w.hookQueue <- rec:
+	default:
+		fmt.Printf("\r\033[K[%s] Alert hook queue full, dropped %s alert\n",
+			time.Now().Format("15:04:05"), rec.Type)
+	}
+}
+
+// startHooks starts the hook worker. The returned function closes the
+// queue and waits for the alerts already queued to be delivered.
+func (w *Watcher) startHooks() func() {
+	w.hookQueue = make(chan alertRecord, hookQueueSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.hookWorker()
+	}()
+	return func() {
+		close(w.hookQueue)
+		<-done
+	}
+}
+
+// hookWorker delivers queued alerts with a simple circuit breaker: once
+// open, alerts are dropped until the cooldown has passed, and the next
+// delivery decides whether it closes again or reopens.
+func (w *Watcher) hookWorker() {
+	var failures, dropped int
+	var openUntil time.Time
+
+	for rec := range w.hookQueue {
+		if time.Now().Before(openUntil) {
+			dropped++
+			continue
+		}
+		if dropped > 0 {
+			fmt.Printf("\r\033[K[%s] Alert hook resumed, %d alerts dropped while paused\n",
+				time.Now().Format("15:04:05"), dropped)
+			dropped = 0
+		}
+
+		if w.execHook(rec) {
+			failures = 0
+			continue
+		}
+		failures++
+		if failures >= hookBreakerFailures {
+			openUntil = time.Now().Add(hookBreakerCooldown)
+			fmt.Printf("\r\033[K[%s] Alert hook failed %d times in a row, pausing it for %v\n",
+				time.Now().Format("15:04:05"), failures, metrics.FormatDuration(hookBreakerCooldown))
+			failures = hookBreakerFailures - 1
+		}
+	}
+	if dropped > 0 {
+		fmt.Printf("\r\033[K[%s] Alert hook still paused, %d alerts dropped\n",
+			time.Now().Format("15:04:05"), dropped)
+	}
+}
+
+// execHook runs the OnAlert command through the system shell, killing it
+// once OnAlertTimeout passes, and reports whether it exited with status 0.
+func (w *Watcher) execHook(rec alertRecord) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), w.Config.OnAlertTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, w.Config.OnAlert)
+	cmd.Env = append(os.Environ(),
+		"PULSEGO_ALERT_TYPE="+rec.Type,
+		"PULSEGO_ALERT_VALUE="+strconv.FormatFloat(rec.Value, 'f', -1, 64),
+		"PULSEGO_ALERT_THRESHOLD="+strconv.FormatFloat(rec.Threshold, 'f', -1, 64),
+		"PULSEGO_ALERT_UNIT="+rec.Unit,
+		"PULSEGO_ALERT_TIMESTAMP="+rec.Timestamp.Format(time.RFC3339),
+		"PULSEGO_ALERT_TARGET="+rec.Target,
+		"PULSEGO_ALERT_RESOLVED="+strconv.FormatBool(rec.Resolved),
+		"PULSEGO_ALERT_DURATION_MS="+strconv.FormatFloat(rec.DurationMs, 'f', 0, 64),
+	)
+	// Scripts that leave children holding stdout open must not keep
+	// the hook alive past its timeout.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	ts := time.Now().Format("15:04:05")
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		fmt.Printf("\r\033[K[%s] Alert hook (%s) killed after %v\n", ts, rec.Type, metrics.FormatDuration(w.Config.OnAlertTimeout))
+	case errors.As(err, &exitErr):
+		fmt.Printf("\r\033[K[%s] Alert hook (%s) exited with status %d\n", ts, rec.Type, exitErr.ExitCode())
+	case err != nil:
+		fmt.Printf("\r\033[K[%s] Alert hook (%s) failed: %v\n", ts, rec.Type, err)
+	default:
+		fmt.Printf("\r\033[K[%s] Alert hook (%s) exited with status 0\n", ts, rec.Type)
+		return true
+	}
+	return false
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,21 @@
+package watchdog
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadAverage returns the 1-minute load average from /proc/loadavg.
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
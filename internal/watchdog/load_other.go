@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watchdog
+
+// loadAverage is unavailable outside Linux, which turns the load guard
+// into a no-op.
+func loadAverage() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,166 @@
+package watchdog
+
+import (
+	"maps"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// StatsSnapshot is a point-in-time copy of Stats that shares nothing with
+// the running watcher, so it can be read without locking.
+type StatsSnapshot struct {
+	Samples       int
+	Failed        int
+	Retried       int
+	Skipped       int
+	LatencyMin    time.Duration
+	LatencyMax    time.Duration
+	LatencySum    time.Duration
+	JitterMin     time.Duration
+	JitterMax     time.Duration
+	JitterSum     time.Duration
+	LossSum       float64
+	LatencyAlerts int
+	JitterAlerts  int
+	LossAlerts    int
+	GradeCounts   map[string]int
+	ScoreSum      int
+	SessionScore  int
+
+	BandwidthSamples int
+	BandwidthMin     float64
+	BandwidthMax     float64
+	BandwidthSum     float64
+	BandwidthAlerts  int
+	LastAlert        time.Time
+	LastTick         time.Time
+
+	Recoveries  int
+	RecoverySum time.Duration
+	RecoveryMax time.Duration
+
+	Histogram *metrics.Histogram
+}
+
+// Snapshot copies the current aggregates under the read lock. It is safe
+// to call from another goroutine while the watcher runs.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := StatsSnapshot{
+		Samples:       s.Samples,
+		Failed:        s.Failed,
+		Retried:       s.Retried,
+		Skipped:       s.Skipped,
+		LatencyMin:    s.LatencyMin,
+		LatencyMax:    s.LatencyMax,
+		LatencySum:    s.LatencySum,
+		JitterMin:     s.JitterMin,
+		JitterMax:     s.JitterMax,
+		JitterSum:     s.JitterSum,
+		LossSum:       s.LossSum,
+		LatencyAlerts: s.LatencyAlerts,
+		JitterAlerts:  s.JitterAlerts,
+		LossAlerts:    s.LossAlerts,
+		GradeCounts:   maps.Clone(s.GradeCounts),
+		ScoreSum:      s.ScoreSum,
+		SessionScore:  s.SessionScore(),
+
+		BandwidthSamples: s.BandwidthSamples,
+		BandwidthMin:     s.BandwidthMin,
+		BandwidthMax:     s.BandwidthMax,
+		BandwidthSum:     s.BandwidthSum,
+		BandwidthAlerts:  s.BandwidthAlerts,
+		LastAlert:        s.LastAlert,
+		LastTick:         s.LastTick,
+
+		Recoveries:  s.Recoveries,
+		RecoverySum: s.RecoverySum,
+		RecoveryMax: s.RecoveryMax,
+	}
+	if s.Histogram != nil {
+		snap.Histogram = metrics.NewHistogram(s.Histogram.Bounds)
+		snap.Histogram.Merge(s.Histogram)
+	}
+	return snap
+}
+
+// SnapshotJSON is the JSON form of a StatsSnapshot, with durations in
+// milliseconds and averages worked out. Alert times are omitted until
+// there is one.
+type SnapshotJSON struct {
+	Samples      int            `json:"samples"`
+	Failed       int            `json:"failed"`
+	Retried      int            `json:"retried"`
+	Skipped      int            `json:"skipped"`
+	SessionScore int            `json:"session_score"`
+	Grades       map[string]int `json:"grades"`
+
+	LatencyMinMs float64 `json:"latency_min_ms"`
+	LatencyAvgMs float64 `json:"latency_avg_ms"`
+	LatencyMaxMs float64 `json:"latency_max_ms"`
+	JitterMinMs  float64 `json:"jitter_min_ms"`
+	JitterAvgMs  float64 `json:"jitter_avg_ms"`
+	JitterMaxMs  float64 `json:"jitter_max_ms"`
+	LossAvg      float64 `json:"loss_avg"`
+
+	BandwidthProbes  int     `json:"bandwidth_probes,omitempty"`
+	BandwidthMinMbps float64 `json:"bandwidth_min_mbps,omitempty"`
+	BandwidthAvgMbps float64 `json:"bandwidth_avg_mbps,omitempty"`
+	BandwidthMaxMbps float64 `json:"bandwidth_max_mbps,omitempty"`
+
+	LatencyAlerts   int        `json:"latency_alerts"`
+	JitterAlerts    int        `json:"jitter_alerts"`
+	LossAlerts      int        `json:"loss_alerts"`
+	BandwidthAlerts int        `json:"bandwidth_alerts"`
+	Recoveries      int        `json:"recoveries"`
+	MTTRMs          float64    `json:"mttr_ms,omitempty"`
+	LastAlert       *time.Time `json:"last_alert,omitempty"`
+	LastTick        *time.Time `json:"last_tick,omitempty"`
+}
+
+// Export converts the snapshot to its JSON form.
+func (s StatsSnapshot) Export() SnapshotJSON {
+	out := SnapshotJSON{
+		Samples:      s.Samples,
+		Failed:       s.Failed,
+		Retried:      s.Retried,
+		Skipped:      s.Skipped,
+		SessionScore: s.SessionScore,
+		Grades:       s.GradeCounts,
+
+		LatencyMinMs: ms(s.LatencyMin),
+		LatencyMaxMs: ms(s.LatencyMax),
+		JitterMinMs:  ms(s.JitterMin),
+		JitterMaxMs:  ms(s.JitterMax),
+
+		LatencyAlerts:   s.LatencyAlerts,
+		JitterAlerts:    s.JitterAlerts,
+		LossAlerts:      s.LossAlerts,
+		BandwidthAlerts: s.BandwidthAlerts,
+		Recoveries:      s.Recoveries,
+	}
+	if s.Samples > 0 {
+		out.LatencyAvgMs = ms(s.LatencySum / time.Duration(s.Samples))
+		out.JitterAvgMs = ms(s.JitterSum / time.Duration(s.Samples))
+		out.LossAvg = s.LossSum / float64(s.Samples)
+	}
+	if s.BandwidthSamples > 0 {
+		out.BandwidthProbes = s.BandwidthSamples
+		out.BandwidthMinMbps = s.BandwidthMin
+		out.BandwidthAvgMbps = s.BandwidthSum / float64(s.BandwidthSamples)
+		out.BandwidthMaxMbps = s.BandwidthMax
+	}
+	if s.Recoveries > 0 {
+		out.MTTRMs = ms(s.RecoverySum / time.Duration(s.Recoveries))
+	}
+	if !s.LastAlert.IsZero() {
+		out.LastAlert = &s.LastAlert
+	}
+	if !s.LastTick.IsZero() {
+		out.LastTick = &s.LastTick
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package watchdog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LoboGuardian/pulsego/internal/metrics"
+)
+
+// TestSnapshotDuringTicks takes snapshots while the watcher ticks, so that
+// go test -race catches any field Snapshot reads without the lock, and
+// checks each snapshot is consistent and independent of the live Stats.
+func TestSnapshotDuringTicks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	w := NewWatcher(Config{
+		URL:             srv.URL,
+		Interval:        10 * time.Millisecond,
+		Duration:        300 * time.Millisecond,
+		JitterSamples:   2,
+		JitterInterval:  time.Millisecond,
+		GradeScale:      metrics.DefaultGradeScale,
+		HistogramBounds: []time.Duration{time.Millisecond, 10 * time.Millisecond},
+		NoBanner:        true,
+	})
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snap := w.Stats.Snapshot()
+				graded := 0
+				for g, n := range snap.GradeCounts {
+					graded += n
+					snap.GradeCounts[g] = -1
+				}
+				if graded != snap.Samples {
+					t.Errorf("snapshot has %d graded ticks but %d samples", graded, snap.Samples)
+					return
+				}
+				if snap.Histogram != nil && snap.Histogram.Total() > snap.Samples*2 {
+					t.Errorf("histogram holds %d samples, more than %d ticks can have produced", snap.Histogram.Total(), snap.Samples)
+					return
+				}
+				snap.Export()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	if err := w.Start(context.Background()); err != nil && err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+	w.Close()
+
+	snap := w.Stats.Snapshot()
+	if snap.Samples == 0 {
+		t.Fatal("no ticks ran")
+	}
+	for g, n := range snap.GradeCounts {
+		if n < 0 {
+			t.Errorf("grade %s count %d: a snapshot's map is shared with Stats", g, n)
+		}
+	}
+}
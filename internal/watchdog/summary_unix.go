@@ -0,0 +1,40 @@
+//go:build !windows
+
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var summaryHint = fmt.Sprintf("Send SIGUSR1 (kill -USR1 %d) to print the summary without stopping", os.Getpid())
+
+// summaryRequests delivers a value each time SIGUSR1 arrives.
+func summaryRequests() (<-chan struct{}, func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+
+	out := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sig:
+				select {
+				case out <- struct{}{}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out, func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
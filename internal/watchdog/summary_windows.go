@@ -0,0 +1,34 @@
+//go:build windows
+
+package watchdog
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+const summaryHint = "Type s and press Enter to print the summary without stopping"
+
+// summaryRequests delivers a value each time an "s" line is read from
+// standard input, since Windows has no SIGUSR1. The reader goroutine stays
+// blocked on stdin after stop; it ends with the process.
+func summaryRequests() (<-chan struct{}, func()) {
+	out := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if !strings.EqualFold(strings.TrimSpace(scanner.Text()), "s") {
+				continue
+			}
+			select {
+			case out <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return out, func() { close(done) }
+}
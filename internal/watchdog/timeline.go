@@ -0,0 +1,146 @@
+package watchdog
+
+import (
+	"sync"
+	"time"
+)
+
+// timelineTiers sets how the tick history is downsampled: ticks are kept
+// in buckets of the first width for the first span, and as they age they
+// are merged into the coarser buckets of the next tier. Buckets older than
+// the last span are dropped, so a watchdog left running for weeks holds at
+// most about 60 + 60 + 2016 buckets.
+var timelineTiers = []struct {
+	width, span time.Duration
+}{
+	{time.Second, time.Minute},
+	{time.Minute, time.Hour},
+	{5 * time.Minute, 7 * 24 * time.Hour},
+}
+
+// TimelineBucket aggregates the ticks that started within Width of Start.
+// Failed ticks are counted but carry no measurements, so the latency and
+// jitter figures cover Samples - Failed ticks.
+type TimelineBucket struct {
+	Start        time.Time `json:"start"`
+	WidthSeconds float64   `json:"width_seconds"`
+	Samples      int       `json:"samples"`
+	Failed       int       `json:"failed,omitempty"`
+	LatencyMinMs float64   `json:"latency_min_ms,omitempty"`
+	LatencyAvgMs float64   `json:"latency_avg_ms,omitempty"`
+	LatencyMaxMs float64   `json:"latency_max_ms,omitempty"`
+	JitterAvgMs  float64   `json:"jitter_avg_ms,omitempty"`
+	LossAvg      float64   `json:"loss_avg,omitempty"`
+}
+
+type bucket struct {
+	start  time.Time
+	width  time.Duration
+	n      int
+	failed int
+
+	latMin, latMax, latSum time.Duration
+	jitSum                 time.Duration
+	lossSum                float64
+}
+
+func (b *bucket) merge(o bucket) {
+	ok := b.n - b.failed
+	if oOK := o.n - o.failed; oOK > 0 {
+		if ok == 0 || o.latMin < b.latMin {
+			b.latMin = o.latMin
+		}
+		b.latMax = max(b.latMax, o.latMax)
+	}
+	b.n += o.n
+	b.failed += o.failed
+	b.latSum += o.latSum
+	b.jitSum += o.jitSum
+	b.lossSum += o.lossSum
+}
+
+func (b bucket) export() TimelineBucket {
+	t := TimelineBucket{
+		Start:        b.start,
+		WidthSeconds: b.width.Seconds(),
+		Samples:      b.n,
+		Failed:       b.failed,
+	}
+	if ok := b.n - b.failed; ok > 0 {
+		t.LatencyMinMs = ms(b.latMin)
+		t.LatencyMaxMs = ms(b.latMax)
+		t.LatencyAvgMs = ms(b.latSum / time.Duration(ok))
+		t.JitterAvgMs = ms(b.jitSum / time.Duration(ok))
+		t.LossAvg = b.lossSum / float64(ok)
+	}
+	return t
+}
+
+// timeline is the downsampled tick history, one bucket list per tier in
+// time order.
+type timeline struct {
+	mu    sync.Mutex
+	tiers [][]bucket
+}
+
+func (tl *timeline) add(ts time.Time, latency, jitter time.Duration, loss float64) {
+	tl.insert(bucket{start: ts, n: 1, latMin: latency, latMax: latency, latSum: latency, jitSum: jitter, lossSum: loss}, ts)
+}
+
+func (tl *timeline) addFailed(ts time.Time) {
+	tl.insert(bucket{start: ts, n: 1, failed: 1}, ts)
+}
+
+func (tl *timeline) insert(b bucket, now time.Time) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.tiers == nil {
+		tl.tiers = make([][]bucket, len(timelineTiers))
+	}
+	tl.push(0, b)
+
+	// Age the oldest buckets of each tier into the next one.
+	for i, tier := range timelineTiers {
+		for len(tl.tiers[i]) > 0 && now.Sub(tl.tiers[i][0].start) >= tier.span {
+			old := tl.tiers[i][0]
+			tl.tiers[i] = tl.tiers[i][1:]
+			if i+1 < len(timelineTiers) {
+				tl.push(i+1, old)
+			}
+		}
+	}
+}
+
+// push merges b into the last bucket of tier i when it falls in the same
+// slot, or starts a new one.
+func (tl *timeline) push(i int, b bucket) {
+	width := timelineTiers[i].width
+	b.start = b.start.Truncate(width)
+	b.width = width
+	buckets := tl.tiers[i]
+	if n := len(buckets); n > 0 && buckets[n-1].start.Equal(b.start) {
+		buckets[n-1].merge(b)
+		return
+	}
+	tl.tiers[i] = append(buckets, b)
+}
+
+// buckets returns every retained bucket, oldest first.
+func (tl *timeline) buckets() []TimelineBucket {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	var out []TimelineBucket
+	for i := len(tl.tiers) - 1; i >= 0; i-- {
+		for _, b := range tl.tiers[i] {
+			out = append(out, b.export())
+		}
+	}
+	return out
+}
+
+// Timeline returns the downsampled history of the session, oldest first:
+// one-second buckets for the last minute, one-minute buckets for the last
+// hour and five-minute buckets for up to a week before that.
+func (w *Watcher) Timeline() []TimelineBucket {
+	return w.timeline.buckets()
+}
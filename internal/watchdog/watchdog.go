@@ -2,25 +2,86 @@ package watchdog
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"os"
 	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/LoboGuardian/pulsego/internal/engine"
 	"github.com/LoboGuardian/pulsego/internal/metrics"
+	"github.com/LoboGuardian/pulsego/internal/output"
 )
 
 type Config struct {
 	URL              string
 	Interval         time.Duration
+	IntervalJitter   float64
+	Align            bool
+	Duration         time.Duration
+	LatencySamples   int
+	TickRetries      int
 	JitterSamples    int
 	JitterInterval   time.Duration
 	JitterThreshold  time.Duration
 	LatencyThreshold time.Duration
 	LossThreshold    float64
 	GamingMode       bool
+
+	// With AdaptiveMin and AdaptiveMax set, the interval starts at
+	// Interval and shrinks toward AdaptiveMin while the link is degraded
+	// and grows toward AdaptiveMax while it is healthy.
+	AdaptiveMin time.Duration
+	AdaptiveMax time.Duration
+
+	BandwidthEvery     int
+	BandwidthThreshold float64
+
+	// SmoothAlpha, when above 0, displays a grade derived from an
+	// exponential moving average of the per-tick scores with this weight
+	// for the newest tick. The grade distribution still counts raw grades.
+	SmoothAlpha float64
+
+	GradeScale      metrics.GradeScale
+	HistogramBounds []time.Duration
+	RawSamples      io.Writer
+	AlertsOut       io.Writer
+	PlotOut         io.Writer
+
+	// TimelineOut receives the downsampled session history as JSON lines,
+	// one TimelineBucket per line, when the watcher is closed.
+	TimelineOut io.Writer
+
+	// OnAlert is a shell command run for every alert, with the alert in
+	// PULSEGO_ALERT_* environment variables. It is killed after
+	// OnAlertTimeout.
+	OnAlert        string
+	OnAlertTimeout time.Duration
+
+	// BaselineSamples is the number of successful ticks measured without
+	// alerting when the watcher starts. With RelativeThresholds the
+	// latency and jitter thresholds are then taken as margins above the
+	// baseline medians rather than absolute values.
+	BaselineSamples    int
+	RelativeThresholds bool
+
+	// LoadGuard, when above 0, skips a tick while the 1-minute load
+	// average per CPU is above it, so a busy device does not show its own
+	// scheduling delay as network latency. It does nothing where the load
+	// average cannot be read.
+	LoadGuard float64
+
+	// NoBanner leaves out the screen clearing, title, usage hints and
+	// underlines, so the output holds only lines a script can parse.
+	NoBanner bool
 }
 
 type Stats struct {
@@ -37,6 +98,35 @@ type Stats struct {
 	JitterAlerts  int
 	LossAlerts    int
 	GradeCounts   map[string]int
+
+	// ScoreSum adds up the health score of every tick and Failed counts
+	// the ticks whose probe failed; see SessionScore. Retried counts the
+	// ticks that failed at first but succeeded on a retry.
+	ScoreSum int
+	Failed   int
+	Retried  int
+
+	// Skipped counts the ticks the load guard skipped.
+	Skipped int
+
+	BandwidthSamples int
+	BandwidthMin     float64
+	BandwidthMax     float64
+	BandwidthSum     float64
+	BandwidthAlerts  int
+
+	// LastAlert is when the most recent alert fired.
+	LastAlert time.Time
+
+	// LastTick is when the latest tick that probed the target, failed or
+	// not, was taken.
+	LastTick time.Time
+
+	Recoveries  int
+	RecoverySum time.Duration
+	RecoveryMax time.Duration
+
+	Histogram *metrics.Histogram
 }
 
 type Alert struct {
@@ -44,6 +134,23 @@ type Alert struct {
 	Value     interface{}
 	Threshold interface{}
 	Timestamp time.Time
+
+	// Resolved marks a recovery event: the metric is back within its
+	// threshold after having been in alert for Duration.
+	Resolved bool
+	Duration time.Duration
+}
+
+type alertRecord struct {
+	Type      string    `json:"type"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Unit      string    `json:"unit"`
+	Timestamp time.Time `json:"timestamp"`
+	Target    string    `json:"target"`
+
+	Resolved   bool    `json:"resolved,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
 }
 
 type Watcher struct {
@@ -54,54 +161,163 @@ type Watcher struct {
 	running   bool
 	runningMu sync.Mutex
 	stopChan  chan struct{}
+	loopDone  chan struct{}
+	stopHooks func()
+	closeOnce sync.Once
+	closeErr  error
+	rawHeader bool
+	ticks     int
+	started   time.Time
+	hookQueue chan alertRecord
+
+	// active holds the time each alert type first fired, until it recovers.
+	active map[string]time.Time
+
+	smoothed    float64
+	hasSmoothed bool
+
+	base baseline
+
+	// interval is the current adaptive tick interval.
+	interval time.Duration
+
+	timeline timeline
 }
 
 func NewWatcher(cfg Config) *Watcher {
+	stats := &Stats{
+		GradeCounts: make(map[string]int),
+	}
+	if cfg.HistogramBounds != nil {
+		stats.Histogram = metrics.NewHistogram(cfg.HistogramBounds)
+	}
+	if cfg.OnAlertTimeout <= 0 {
+		cfg.OnAlertTimeout = 10 * time.Second
+	}
+
 	return &Watcher{
-		Config: cfg,
-		Stats: &Stats{
-			GradeCounts: make(map[string]int),
-		},
+		Config:   cfg,
+		Stats:    stats,
 		Alerts:   make([]Alert, 0),
 		stopChan: make(chan struct{}),
+		active:   make(map[string]time.Time),
+		interval: cfg.Interval,
 	}
 }
 
 func (w *Watcher) Start(ctx context.Context) error {
+	if w.Config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.Config.Duration)
+		defer cancel()
+	}
+
 	w.runningMu.Lock()
 	w.running = true
+	w.loopDone = make(chan struct{})
 	w.runningMu.Unlock()
+	defer close(w.loopDone)
+
+	// Queued alert hooks are delivered by Close.
+	if w.Config.OnAlert != "" {
+		w.stopHooks = w.startHooks()
+	}
+
+	w.started = time.Now()
+	if w.Config.PlotOut != nil {
+		fmt.Fprintf(w.Config.PlotOut, "# pulsego watch target=%s interval=%v start=%s\n",
+			w.Config.URL, w.Config.Interval, w.started.Format(time.RFC3339))
+		fmt.Fprintln(w.Config.PlotOut, "elapsed_seconds\tlatency_ms\tjitter_ms\tloss\tgrade_numeric")
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	dumps, stopDumps := summaryRequests()
+	defer stopDumps()
 
-	ticker := time.NewTicker(w.Config.Interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(w.nextInterval())
+	defer timer.Stop()
 
-	fmt.Printf("\033[2J\033[H")
-	fmt.Println("PulseGo Watchdog - Network Monitoring")
-	fmt.Println("=====================================")
-	fmt.Printf("Interval: %v | Target: %s\n", w.Config.Interval, w.Config.URL)
+	if !w.Config.NoBanner {
+		fmt.Printf("\033[2J\033[H")
+		fmt.Println("PulseGo Watchdog - Network Monitoring")
+		fmt.Println("=====================================")
+	}
+	if w.Config.IntervalJitter > 0 {
+		fmt.Printf("Interval: %v ±%.0f%% | Target: %s\n", metrics.FormatDuration(w.Config.Interval), w.Config.IntervalJitter*100, w.Config.URL)
+	} else {
+		fmt.Printf("Interval: %v | Target: %s\n", metrics.FormatDuration(w.Config.Interval), w.Config.URL)
+	}
+	if w.Config.Align {
+		fmt.Printf("Ticks aligned to %v wall-clock boundaries\n", metrics.FormatDuration(w.Config.Interval))
+	}
+	if w.adaptive() {
+		fmt.Printf("Adaptive interval: %v to %v, faster while degraded\n", metrics.FormatDuration(w.Config.AdaptiveMin), metrics.FormatDuration(w.Config.AdaptiveMax))
+	}
+	if w.Config.Duration > 0 {
+		fmt.Printf("Duration: %v (stops automatically)\n", metrics.FormatDuration(w.Config.Duration))
+	}
 	if w.Config.GamingMode {
 		fmt.Println("Mode: Gaming (latency-focused, no bandwidth saturation)")
 	}
-	fmt.Println("Press Ctrl+C to stop and see summary")
+	if w.Config.BaselineSamples > 0 {
+		fmt.Printf("Baseline: first %d ticks, no alerts until then\n", w.Config.BaselineSamples)
+	}
+	if !w.Config.NoBanner {
+		fmt.Println("Press Ctrl+C to stop and see summary")
+		fmt.Println(summaryHint)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			if w.Config.Duration > 0 && ctx.Err() == context.DeadlineExceeded {
+				return nil
+			}
 			return ctx.Err()
 		case <-sigChan:
 			return nil
+		case <-dumps:
+			w.PrintSummary()
+			fmt.Println()
 		case <-w.stopChan:
 			return nil
-		case <-ticker.C:
+		case <-timer.C:
 			w.tick(ctx)
+			timer.Reset(w.nextInterval())
 		}
 	}
 }
 
-func (w *Watcher) Stop() {
+// nextInterval returns the wait before the next tick. With Align set it
+// runs to the next multiple of Interval on the wall clock, so hosts with
+// synchronized clocks sample at the same instants whenever they started
+// and however long a tick took. With IntervalJitter set it is drawn
+// uniformly from Interval ± that fraction, so watchdogs started together
+// on a fleet drift apart instead of probing in lockstep.
+func (w *Watcher) nextInterval() time.Duration {
+	if w.Config.Align {
+		now := time.Now()
+		return now.Truncate(w.Config.Interval).Add(w.Config.Interval).Sub(now)
+	}
+	interval := w.currentInterval()
+	j := w.Config.IntervalJitter
+	if j <= 0 {
+		return interval
+	}
+	factor := 1 + j*(2*rand.Float64()-1)
+	return time.Duration(float64(interval) * factor)
+}
+
+// Stop ends a running Start and closes the watcher.
+func (w *Watcher) Stop() error {
+	w.halt()
+	return w.Close()
+}
+
+func (w *Watcher) halt() {
 	w.runningMu.Lock()
 	defer w.runningMu.Unlock()
 	if w.running {
@@ -112,47 +328,232 @@ func (w *Watcher) Stop() {
 
 func (w *Watcher) tick(ctx context.Context) {
 	timestamp := time.Now()
-	latencyResult, err := metrics.MeasureLatency(ctx, w.Config.URL)
+	if load, busy := w.overloaded(); busy {
+		fmt.Printf("\r\033[K[%s] Skipped: load %.2f on %d CPUs is above -load-guard %g per CPU\n",
+			timestamp.Format("15:04:05"), load, runtime.NumCPU(), w.Config.LoadGuard)
+		w.Stats.mu.Lock()
+		w.Stats.Skipped++
+		w.Stats.mu.Unlock()
+		return
+	}
+	w.ticks++
+	latency, minLatency, maxLatency, err := w.sampleLatency(ctx)
+	for retry := 0; err != nil && retry < w.Config.TickRetries && ctx.Err() == nil; retry++ {
+		latency, minLatency, maxLatency, err = w.sampleLatency(ctx)
+		if err == nil {
+			w.Stats.mu.Lock()
+			w.Stats.Retried++
+			w.Stats.mu.Unlock()
+		}
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		fmt.Printf("\r\033[K[%s] Error: %v\n", timestamp.Format("15:04:05"), err)
+		w.Stats.mu.Lock()
+		w.Stats.Failed++
+		w.Stats.LastTick = timestamp
+		w.Stats.mu.Unlock()
+		w.adapt("", true, false)
+		w.writePlot(timestamp, 0, 0, 0, 0, false)
+		w.timeline.addFailed(timestamp)
 		return
 	}
 
 	var jitterResult *metrics.JitterResult
 	if w.Config.JitterSamples > 0 {
-		jitterResult, _ = metrics.MeasureJitter(ctx, w.Config.URL, w.Config.JitterSamples, w.Config.JitterInterval)
+		jitterResult, _ = metrics.MeasureJitter(ctx, w.Config.URL, w.Config.JitterSamples, w.Config.JitterInterval, w.Config.HistogramBounds)
+	}
+
+	if jitterResult != nil && w.Config.RawSamples != nil {
+		if err := output.WriteSamplesCSV(w.Config.RawSamples, jitterResult.Raw, !w.rawHeader); err != nil {
+			fmt.Printf("\r\033[K[%s] Raw sample write failed: %v\n", timestamp.Format("15:04:05"), err)
+		}
+		w.rawHeader = true
 	}
 
 	var jitter time.Duration
 	var loss float64
+	var hist *metrics.Histogram
 	if jitterResult != nil {
 		jitter = jitterResult.Jitter
 		loss = jitterResult.PacketLoss
+		hist = jitterResult.Histogram
+	}
+
+	var bandwidth float64
+	if w.probeDue() {
+		bandwidth = w.probeBandwidth(ctx)
 	}
 
-	health := metrics.CalculateHealthScore(0, jitter, latencyResult.Latency, "Unknown")
+	health := metrics.CalculateHealthScore(0, jitterResult, latency, "Unknown", w.Config.GradeScale)
 
-	w.updateStats(latencyResult.Latency, jitter, loss, health.Grade)
+	w.updateStats(timestamp, latency, minLatency, maxLatency, jitter, loss, health, hist)
+	w.timeline.add(timestamp, latency, jitter, loss)
 
-	alerts := w.checkAlerts(latencyResult.Latency, jitter, loss)
+	var alerts []Alert
+	if w.warmingUp() {
+		w.addBaseline(timestamp, latency, jitter)
+	} else {
+		alerts = w.checkAlerts(latency, jitter, loss)
+		if bandwidth > 0 {
+			if alert, ok := w.checkBandwidth(bandwidth); ok {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
 	for _, alert := range alerts {
 		w.addAlert(alert)
 	}
 
-	w.printLine(timestamp, latencyResult.Latency, jitter, loss, health.Grade, len(alerts) > 0)
+	current := map[string]interface{}{"latency": latency, "jitter": jitter, "loss": loss}
+	if bandwidth > 0 {
+		current["bandwidth"] = bandwidth
+	}
+	recoveries := w.trackRecoveries(alerts, current)
+
+	shown := health.Grade
+	if w.Config.SmoothAlpha > 0 {
+		shown = w.smoothGrade(health.Score)
+	}
+
+	w.adapt(health.Grade, false, len(alerts) > 0)
+	w.printLine(timestamp, latency, jitter, loss, bandwidth, shown, len(alerts) > 0)
+	for _, rec := range recoveries {
+		w.resolve(rec)
+	}
+	w.writePlot(timestamp, latency, jitter, loss, health.GradeValue, true)
+}
+
+// overloaded reports whether the load guard should skip this tick, with
+// the load average it read.
+func (w *Watcher) overloaded() (float64, bool) {
+	if w.Config.LoadGuard <= 0 {
+		return 0, false
+	}
+	load, ok := loadAverage()
+	return load, ok && load/float64(runtime.NumCPU()) > w.Config.LoadGuard
+}
+
+// writePlot appends one tab-separated row to PlotOut. A failed tick is
+// written as NaN so plots show the gap rather than skipping over it.
+func (w *Watcher) writePlot(ts time.Time, latency, jitter time.Duration, loss float64, grade int, ok bool) {
+	if w.Config.PlotOut == nil {
+		return
+	}
+
+	elapsed := ts.Sub(w.started).Seconds()
+	var err error
+	if ok {
+		_, err = fmt.Fprintf(w.Config.PlotOut, "%.3f\t%.3f\t%.3f\t%.2f\t%d\n", elapsed, ms(latency), ms(jitter), loss, grade)
+	} else {
+		_, err = fmt.Fprintf(w.Config.PlotOut, "%.3f\tNaN\tNaN\tNaN\tNaN\n", elapsed)
+	}
+	if err != nil {
+		fmt.Printf("\r\033[K[%s] Plot write failed: %v\n", ts.Format("15:04:05"), err)
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ago describes how long before now t was, in its largest whole unit,
+// e.g. "40s ago" or "3m ago", for scanning a long session at a glance.
+func ago(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// sampleLatency takes LatencySamples measurements and returns their median
+// along with the fastest and slowest sample, so a single outlier neither
+// moves the displayed value nor trips an alert.
+func (w *Watcher) sampleLatency(ctx context.Context) (median, min, max time.Duration, err error) {
+	n := w.Config.LatencySamples
+	if n < 1 {
+		n = 1
+	}
+
+	latencies := make([]time.Duration, 0, n)
+	for i := 0; i < n; i++ {
+		result, e := metrics.MeasureLatency(ctx, w.Config.URL)
+		if e != nil {
+			err = e
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		latencies = append(latencies, result.Latency)
+		if len(latencies) == 1 || result.Latency < min {
+			min = result.Latency
+		}
+		if result.Latency > max {
+			max = result.Latency
+		}
+	}
+
+	if len(latencies) == 0 {
+		return 0, 0, 0, err
+	}
+	return metrics.Median(latencies), min, max, nil
+}
+
+func (w *Watcher) probeDue() bool {
+	if w.Config.GamingMode || w.Config.BandwidthEvery <= 0 {
+		return false
+	}
+	return (w.ticks-1)%w.Config.BandwidthEvery == 0
+}
+
+func (w *Watcher) probeBandwidth(ctx context.Context) float64 {
+	result, err := engine.Run(ctx, engine.Config{
+		URL:       w.Config.URL,
+		Downloads: 1,
+		Timeout:   30 * time.Second,
+	})
+	if err != nil {
+		return 0
+	}
+
+	w.Stats.mu.Lock()
+	defer w.Stats.mu.Unlock()
+	mbps := result.DownloadSpeed
+	w.Stats.BandwidthSamples++
+	if w.Stats.BandwidthSamples == 1 || mbps < w.Stats.BandwidthMin {
+		w.Stats.BandwidthMin = mbps
+	}
+	if mbps > w.Stats.BandwidthMax {
+		w.Stats.BandwidthMax = mbps
+	}
+	w.Stats.BandwidthSum += mbps
+	return mbps
 }
 
-func (w *Watcher) updateStats(latency, jitter time.Duration, loss float64, grade string) {
+func (w *Watcher) updateStats(timestamp time.Time, latency, minLatency, maxLatency, jitter time.Duration, loss float64, health *metrics.HealthScore, hist *metrics.Histogram) {
 	w.Stats.mu.Lock()
 	defer w.Stats.mu.Unlock()
 
 	w.Stats.Samples++
+	w.Stats.LastTick = timestamp
 
-	if w.Stats.Samples == 1 || latency < w.Stats.LatencyMin {
-		w.Stats.LatencyMin = latency
+	if w.Stats.Samples == 1 || minLatency < w.Stats.LatencyMin {
+		w.Stats.LatencyMin = minLatency
 	}
-	if latency > w.Stats.LatencyMax {
-		w.Stats.LatencyMax = latency
+	if maxLatency > w.Stats.LatencyMax {
+		w.Stats.LatencyMax = maxLatency
 	}
 	w.Stats.LatencySum += latency
 
@@ -167,7 +568,16 @@ func (w *Watcher) updateStats(latency, jitter time.Duration, loss float64, grade
 	}
 
 	w.Stats.LossSum += loss
-	w.Stats.GradeCounts[grade]++
+	w.Stats.GradeCounts[health.Grade]++
+	w.Stats.ScoreSum += health.Score
+
+	if w.Stats.Histogram != nil {
+		if hist != nil {
+			w.Stats.Histogram.Merge(hist)
+		} else {
+			w.Stats.Histogram.Add(latency)
+		}
+	}
 }
 
 func (w *Watcher) checkAlerts(latency, jitter time.Duration, loss float64) []Alert {
@@ -183,6 +593,7 @@ func (w *Watcher) checkAlerts(latency, jitter time.Duration, loss float64) []Ale
 		})
 		w.Stats.mu.Lock()
 		w.Stats.LatencyAlerts++
+		w.Stats.LastAlert = now
 		w.Stats.mu.Unlock()
 	}
 
@@ -195,6 +606,7 @@ func (w *Watcher) checkAlerts(latency, jitter time.Duration, loss float64) []Ale
 		})
 		w.Stats.mu.Lock()
 		w.Stats.JitterAlerts++
+		w.Stats.LastAlert = now
 		w.Stats.mu.Unlock()
 	}
 
@@ -207,12 +619,32 @@ func (w *Watcher) checkAlerts(latency, jitter time.Duration, loss float64) []Ale
 		})
 		w.Stats.mu.Lock()
 		w.Stats.LossAlerts++
+		w.Stats.LastAlert = now
 		w.Stats.mu.Unlock()
 	}
 
 	return alerts
 }
 
+func (w *Watcher) checkBandwidth(mbps float64) (Alert, bool) {
+	if w.Config.BandwidthThreshold <= 0 || mbps >= w.Config.BandwidthThreshold {
+		return Alert{}, false
+	}
+
+	now := time.Now()
+	w.Stats.mu.Lock()
+	w.Stats.BandwidthAlerts++
+	w.Stats.LastAlert = now
+	w.Stats.mu.Unlock()
+
+	return Alert{
+		Type:      "bandwidth",
+		Value:     mbps,
+		Threshold: w.Config.BandwidthThreshold,
+		Timestamp: now,
+	}, true
+}
+
 func (w *Watcher) addAlert(alert Alert) {
 	w.alertsMu.Lock()
 	defer w.alertsMu.Unlock()
@@ -222,9 +654,150 @@ func (w *Watcher) addAlert(alert Alert) {
 	if len(w.Alerts) > maxAlerts {
 		w.Alerts = w.Alerts[len(w.Alerts)-maxAlerts:]
 	}
+
+	if w.Config.AlertsOut != nil {
+		w.writeAlert(alert)
+	}
+	if w.Config.OnAlert != "" {
+		w.runAlertHook(alert)
+	}
+}
+
+// trackRecoveries updates which alert types are active and returns a
+// recovery event for each one that was active and is now back within its
+// threshold. current holds this tick's value for every metric that was
+// checked; metrics not checked this tick keep their state.
+func (w *Watcher) trackRecoveries(alerts []Alert, current map[string]interface{}) []Alert {
+	now := time.Now()
+	firing := make(map[string]bool)
+	for _, a := range alerts {
+		firing[a.Type] = true
+		if _, ok := w.active[a.Type]; !ok {
+			w.active[a.Type] = a.Timestamp
+		}
+	}
+
+	var recoveries []Alert
+	for typ, since := range w.active {
+		value, checked := current[typ]
+		if !checked || firing[typ] {
+			continue
+		}
+		delete(w.active, typ)
+		recoveries = append(recoveries, Alert{
+			Type:      typ,
+			Value:     value,
+			Threshold: w.threshold(typ),
+			Timestamp: now,
+			Resolved:  true,
+			Duration:  now.Sub(since),
+		})
+	}
+	sort.Slice(recoveries, func(i, j int) bool { return recoveries[i].Type < recoveries[j].Type })
+	return recoveries
+}
+
+func (w *Watcher) threshold(alertType string) interface{} {
+	switch alertType {
+	case "latency":
+		return w.Config.LatencyThreshold
+	case "jitter":
+		return w.Config.JitterThreshold
+	case "loss":
+		return w.Config.LossThreshold
+	case "bandwidth":
+		return w.Config.BandwidthThreshold
+	default:
+		return nil
+	}
+}
+
+// resolve reports a recovery on the console and to the same feed and hook
+// as alerts.
+func (w *Watcher) resolve(rec Alert) {
+	w.Stats.mu.Lock()
+	w.Stats.Recoveries++
+	w.Stats.RecoverySum += rec.Duration
+	if rec.Duration > w.Stats.RecoveryMax {
+		w.Stats.RecoveryMax = rec.Duration
+	}
+	w.Stats.mu.Unlock()
+
+	fmt.Printf("\r\033[K[%s] \033[32mRESOLVED\033[0m %s back within threshold after %v\n",
+		rec.Timestamp.Format("15:04:05"), rec.Type, metrics.FormatDuration(rec.Duration))
+
+	if w.Config.AlertsOut != nil {
+		w.writeAlert(rec)
+	}
+	if w.Config.OnAlert != "" {
+		w.runAlertHook(rec)
+	}
+}
+
+func (w *Watcher) record(alert Alert) alertRecord {
+	return alertRecord{
+		Type:      alert.Type,
+		Value:     alertValue(alert.Value),
+		Threshold: alertValue(alert.Threshold),
+		Unit:      alertUnit(alert.Type),
+		Timestamp: alert.Timestamp,
+		Target:    w.Config.URL,
+
+		Resolved:   alert.Resolved,
+		DurationMs: alertValue(alert.Duration),
+	}
+}
+
+func (w *Watcher) writeAlert(alert Alert) {
+	rec := w.record(alert)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	if _, err := w.Config.AlertsOut.Write(data); err != nil {
+		fmt.Printf("\r\033[K[%s] Alert feed write failed: %v\n", alert.Timestamp.Format("15:04:05"), err)
+	}
+}
+
+func alertValue(v interface{}) float64 {
+	switch v := v.(type) {
+	case time.Duration:
+		return float64(v) / float64(time.Millisecond)
+	case float64:
+		return v
+	default:
+		return 0
+	}
 }
 
-func (w *Watcher) printLine(ts time.Time, latency, jitter time.Duration, loss float64, grade string, hasAlert bool) {
+func alertUnit(alertType string) string {
+	switch alertType {
+	case "latency", "jitter":
+		return "ms"
+	case "loss":
+		return "%"
+	case "bandwidth":
+		return "Mbps"
+	default:
+		return ""
+	}
+}
+
+// smoothGrade folds score into the moving average and returns the grade
+// for the average, labelled so it is not mistaken for the tick's own grade.
+func (w *Watcher) smoothGrade(score int) string {
+	if !w.hasSmoothed {
+		w.smoothed = float64(score)
+		w.hasSmoothed = true
+	} else {
+		w.smoothed = w.Config.SmoothAlpha*float64(score) + (1-w.Config.SmoothAlpha)*w.smoothed
+	}
+	band := w.Config.GradeScale.ForScore(int(math.Round(w.smoothed)))
+	return fmt.Sprintf("%s (smoothed %.0f)", band.Grade, w.smoothed)
+}
+
+func (w *Watcher) printLine(ts time.Time, latency, jitter time.Duration, loss, bandwidth float64, grade string, hasAlert bool) {
 	alertMarker := " "
 	if hasAlert {
 		alertMarker = "!"
@@ -232,7 +805,7 @@ func (w *Watcher) printLine(ts time.Time, latency, jitter time.Duration, loss fl
 
 	jitterStr := "--"
 	if jitter > 0 {
-		jitterStr = fmt.Sprintf("%v", jitter.Round(time.Millisecond))
+		jitterStr = metrics.FormatDuration(jitter)
 	}
 
 	lossStr := "--"
@@ -240,82 +813,225 @@ func (w *Watcher) printLine(ts time.Time, latency, jitter time.Duration, loss fl
 		lossStr = fmt.Sprintf("%.1f%%", loss)
 	}
 
-	gradeColor := gradeColor(grade)
-	fmt.Printf("\r\033[K[%s] %s Lat: %-8v Jitter: %-8v Loss: %-6s %s%s\033[0m",
+	bwStr := ""
+	if bandwidth > 0 {
+		bwStr = fmt.Sprintf("BW: %.1f Mbps ", bandwidth)
+	}
+	if w.adaptive() {
+		bwStr += fmt.Sprintf("Every: %-6v ", metrics.FormatDuration(w.interval))
+	}
+
+	gradeColor := w.gradeColor(strings.SplitN(grade, " ", 2)[0])
+	fmt.Printf("\r\033[K[%s] %s Lat: %-8v Jitter: %-8v Loss: %-6s %s%s%s\033[0m",
 		ts.Format("15:04:05"),
 		alertMarker,
-		latency.Round(time.Millisecond),
+		metrics.FormatDuration(latency),
 		jitterStr,
 		lossStr,
+		bwStr,
 		gradeColor,
 		grade,
 	)
 }
 
-func gradeColor(grade string) string {
-	switch grade {
-	case "A":
+func (w *Watcher) gradeColor(grade string) string {
+	rank := w.Config.GradeScale.Rank(grade)
+	last := len(w.Config.GradeScale.Grades()) - 1
+	switch {
+	case rank < 0:
+		return "\033[0m"
+	case rank == 0:
 		return "\033[32m"
-	case "B":
+	case rank == last:
+		return "\033[31m"
+	case rank == 1:
 		return "\033[36m"
-	case "C":
+	case rank == 2:
 		return "\033[33m"
-	case "D", "F":
-		return "\033[31m"
 	default:
-		return "\033[0m"
+		return "\033[31m"
+	}
+}
+
+// SessionScore is the mean health score over every tick of the session,
+// with a tick whose probe failed counted as 0. It is 0 before the first
+// tick. The caller must hold Stats.mu.
+func (s *Stats) SessionScore() int {
+	ticks := s.Samples + s.Failed
+	if ticks == 0 {
+		return 0
 	}
+	return int(math.Round(float64(s.ScoreSum) / float64(ticks)))
 }
 
+// mostlyGrades names the most common grades of snap, best first, that
+// together cover at least three quarters of the graded ticks, e.g. "A/B".
+func (w *Watcher) mostlyGrades(snap StatsSnapshot) string {
+	grades := w.Config.GradeScale.Grades()
+	byCount := append([]string(nil), grades...)
+	sort.SliceStable(byCount, func(i, j int) bool {
+		return snap.GradeCounts[byCount[i]] > snap.GradeCounts[byCount[j]]
+	})
+
+	picked := make(map[string]bool)
+	covered := 0
+	for _, g := range byCount {
+		if covered*4 >= snap.Samples*3 || snap.GradeCounts[g] == 0 {
+			break
+		}
+		picked[g] = true
+		covered += snap.GradeCounts[g]
+	}
+
+	var names []string
+	for _, g := range grades {
+		if picked[g] {
+			names = append(names, g)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// PrintSummary prints the session aggregates. It works from a snapshot of
+// Stats, so it can run from the SIGUSR1 handler while ticks continue.
 func (w *Watcher) PrintSummary() {
-	w.Stats.mu.RLock()
-	defer w.Stats.mu.RUnlock()
+	snap := w.Stats.Snapshot()
 
 	fmt.Println("\n\nSummary")
-	fmt.Println("=======")
-	fmt.Printf("Samples: %d | Duration: ~%v\n", w.Stats.Samples, time.Duration(w.Stats.Samples)*w.Config.Interval)
+	if !w.Config.NoBanner {
+		fmt.Println("=======")
+	}
+	var elapsed time.Duration
+	if !snap.LastTick.IsZero() {
+		elapsed = snap.LastTick.Sub(w.started)
+	}
+	fmt.Printf("Samples: %d | Duration: %v\n", snap.Samples, metrics.FormatDuration(elapsed))
+	if snap.Samples > 0 {
+		fmt.Printf("Session Health: %d/100 (mostly %s)\n", snap.SessionScore, w.mostlyGrades(snap))
+		if snap.Failed > 0 {
+			fmt.Printf("  %d failed ticks counted as 0\n", snap.Failed)
+		}
+		if snap.Retried > 0 {
+			fmt.Printf("  %d ticks succeeded only on retry\n", snap.Retried)
+		}
+	}
+	if snap.Skipped > 0 {
+		fmt.Printf("  %d ticks skipped under high system load\n", snap.Skipped)
+	}
+
+	if w.base.done {
+		fmt.Printf("\nBaseline:\n")
+		fmt.Printf("  Latency: %v | Jitter: %v\n", metrics.FormatDuration(w.base.latency), metrics.FormatDuration(w.base.jitter))
+	}
 
-	if w.Stats.Samples > 0 {
-		avgLatency := w.Stats.LatencySum / time.Duration(w.Stats.Samples)
+	if snap.Samples > 0 {
+		avgLatency := snap.LatencySum / time.Duration(snap.Samples)
 		fmt.Printf("\nLatency:\n")
 		fmt.Printf("  Min: %v | Max: %v | Avg: %v\n",
-			w.Stats.LatencyMin.Round(time.Millisecond),
-			w.Stats.LatencyMax.Round(time.Millisecond),
-			avgLatency.Round(time.Millisecond))
+			metrics.FormatDuration(snap.LatencyMin),
+			metrics.FormatDuration(snap.LatencyMax),
+			metrics.FormatDuration(avgLatency))
 	}
 
-	if w.Stats.JitterSum > 0 {
-		samplesWithJitter := w.Stats.Samples
-		avgJitter := w.Stats.JitterSum / time.Duration(samplesWithJitter)
+	if snap.JitterSum > 0 {
+		samplesWithJitter := snap.Samples
+		avgJitter := snap.JitterSum / time.Duration(samplesWithJitter)
 		fmt.Printf("\nJitter:\n")
 		fmt.Printf("  Min: %v | Max: %v | Avg: %v\n",
-			w.Stats.JitterMin.Round(time.Millisecond),
-			w.Stats.JitterMax.Round(time.Millisecond),
-			avgJitter.Round(time.Millisecond))
+			metrics.FormatDuration(snap.JitterMin),
+			metrics.FormatDuration(snap.JitterMax),
+			metrics.FormatDuration(avgJitter))
 	}
 
-	if w.Stats.Samples > 0 {
-		avgLoss := w.Stats.LossSum / float64(w.Stats.Samples)
+	if snap.Samples > 0 {
+		avgLoss := snap.LossSum / float64(snap.Samples)
 		fmt.Printf("\nPacket Loss:\n")
 		fmt.Printf("  Avg: %.2f%%\n", avgLoss)
 	}
 
+	if snap.BandwidthSamples > 0 {
+		fmt.Printf("\nBandwidth:\n")
+		fmt.Printf("  Min: %.2f Mbps | Max: %.2f Mbps | Avg: %.2f Mbps | Probes: %d\n",
+			snap.BandwidthMin,
+			snap.BandwidthMax,
+			snap.BandwidthSum/float64(snap.BandwidthSamples),
+			snap.BandwidthSamples)
+	}
+
+	if snap.Histogram != nil && snap.Histogram.Total() > 0 {
+		fmt.Printf("\nLatency Distribution:\n")
+		fmt.Print(snap.Histogram.Bars(20))
+	}
+
 	fmt.Printf("\nGrade Distribution:\n")
-	for _, g := range []string{"A", "B", "C", "D", "F"} {
-		count := w.Stats.GradeCounts[g]
+	for _, g := range w.Config.GradeScale.Grades() {
+		count := snap.GradeCounts[g]
 		if count > 0 {
 			bar := ""
 			for i := 0; i < count && i < 20; i++ {
 				bar += "="
 			}
-			fmt.Printf("  %s: %d %s\033[0m\n", gradeColor(g), count, bar)
+			fmt.Printf("  %s%s: %d %s\033[0m\n", w.gradeColor(g), g, count, bar)
 		}
 	}
 
-	totalAlerts := w.Stats.LatencyAlerts + w.Stats.JitterAlerts + w.Stats.LossAlerts
+	totalAlerts := snap.LatencyAlerts + snap.JitterAlerts + snap.LossAlerts + snap.BandwidthAlerts
 	if totalAlerts > 0 {
 		fmt.Printf("\nAlerts:\n")
-		fmt.Printf("  Latency: %d | Jitter: %d | Loss: %d | Total: %d\n",
-			w.Stats.LatencyAlerts, w.Stats.JitterAlerts, w.Stats.LossAlerts, totalAlerts)
+		fmt.Printf("  Latency: %d | Jitter: %d | Loss: %d | Bandwidth: %d | Total: %d\n",
+			snap.LatencyAlerts, snap.JitterAlerts, snap.LossAlerts, snap.BandwidthAlerts, totalAlerts)
+		if snap.Recoveries > 0 {
+			fmt.Printf("  Recoveries: %d | MTTR: %v | Longest: %v\n",
+				snap.Recoveries,
+				metrics.FormatDuration(snap.RecoverySum/time.Duration(snap.Recoveries)),
+				metrics.FormatDuration(snap.RecoveryMax))
+		}
+		now := time.Now()
+		fmt.Printf("  Last alert: %s (%s)\n", ago(snap.LastAlert, now), snap.LastAlert.Format("15:04:05"))
+		w.printRecentAlerts(now)
+	}
+}
+
+// summaryAlerts is how many of the latest alerts the summary lists.
+const summaryAlerts = 5
+
+// printRecentAlerts lists the latest alerts, newest first, each with its
+// clock time and how long ago it fired.
+func (w *Watcher) printRecentAlerts(now time.Time) {
+	w.alertsMu.Lock()
+	recent := w.Alerts[max(len(w.Alerts)-summaryAlerts, 0):]
+	recent = append([]Alert(nil), recent...)
+	w.alertsMu.Unlock()
+	if len(recent) == 0 {
+		return
+	}
+
+	fmt.Printf("  Recent:\n")
+	for i := len(recent) - 1; i >= 0; i-- {
+		a := recent[i]
+		fmt.Printf("    %s %-8s %s\n", a.Timestamp.Format("15:04:05"), ago(a.Timestamp, now), describeAlert(a))
+	}
+}
+
+// describeAlert states an alert's value against its threshold, e.g.
+// "latency 182ms > 100ms".
+func describeAlert(a Alert) string {
+	format := func(v interface{}) string {
+		switch v := v.(type) {
+		case time.Duration:
+			return metrics.FormatDuration(v)
+		case float64:
+			if a.Type == "bandwidth" {
+				return fmt.Sprintf("%.1f Mbps", v)
+			}
+			return fmt.Sprintf("%.1f%s", v, alertUnit(a.Type))
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	op := ">"
+	if a.Type == "bandwidth" {
+		op = "<"
 	}
+	return fmt.Sprintf("%s %s %s %s", a.Type, format(a.Value), op, format(a.Threshold))
 }